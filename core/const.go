@@ -20,7 +20,12 @@ const (
 	// config key
 	ConfigServiceAddr           = "http.address"            // config http address key
 	ConfigServiceAdvertisedAddr = "http.advertised_address" // config http advertise address key
+	ConfigServiceTLS            = "http.tls"                // config http tls key
+	ConfigAdminAddr             = "admin.address"           // config admin address key
+	ConfigAdminIntranetOnly     = "admin.intranetOnly"      // config admin intranet only key, default true
+	ConfigAdminGopsAddr         = "admin.gops"              // config gops agent address key
 
 	ServiceConfigKeyPrefix   = "xservice/config"   // service config key prefix
 	ServiceRegisterKeyPrefix = "xservice/register" // service register key prefix
+	ServiceElectionKeyPrefix = "xservice/election" // leader election key prefix
 )
@@ -0,0 +1,122 @@
+package xservice
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/tableflip"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/core"
+	"github.com/xinpianchang/xservice/core/middleware"
+	"github.com/xinpianchang/xservice/pkg/cronx"
+	"github.com/xinpianchang/xservice/pkg/echox"
+	"github.com/xinpianchang/xservice/pkg/health"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+var (
+	// sensitive config keys, value will be masked in config dump
+	sensitiveConfigKeys = []string{"password", "secret", "token", "uri", "dsn"}
+)
+
+// adminEnabled check whether admin server configured,
+// metrics & pprof only served by admin server if enabled
+func (t *serverImpl) adminEnabled() bool {
+	return t.options.Config.GetString(core.ConfigAdminAddr) != ""
+}
+
+// initAdmin init internal admin server, which hosts metrics & pprof & health & config & log level & cron jobs
+func (t *serverImpl) initAdmin() {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Logger = log.NewEchoLogger()
+	e.HTTPErrorHandler = echox.HTTPErrorHandler
+	// admin is served directly, forwarded headers are spoofable and must not be trusted
+	e.IPExtractor = echo.ExtractIPDirect()
+
+	t.options.Config.SetDefault(core.ConfigAdminIntranetOnly, true)
+	if t.options.Config.GetBool(core.ConfigAdminIntranetOnly) {
+		e.Use(echox.IntranetOnly)
+	}
+
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.Group("/debug/*", middleware.Pprof())
+	e.GET("/healthz", health.LivenessHandler())
+	e.GET("/readyz", health.ReadinessHandler())
+	e.GET("/config", t.configDump)
+	e.Any("/log/level", echo.WrapHandler(log.LevelHandler()))
+	cronx.RegisterHandler(e.Group("/cron"))
+
+	t.admin = e
+}
+
+// serveAdmin listen admin server via tableflip, stopped after public server drained
+func (t *serverImpl) serveAdmin(upg *tableflip.Upgrader) {
+	address := t.options.Config.GetString(core.ConfigAdminAddr)
+	log.Debug("serve admin", zap.String("address", address))
+
+	ln, err := upg.Fds.Listen("tcp", address)
+	if err != nil {
+		log.Fatal("listen admin", zap.Error(err))
+	}
+
+	server := &http.Server{
+		Handler:           t.admin,
+		ReadHeaderTimeout: time.Second * 30,
+	}
+
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error("admin server", zap.Error(err))
+		}
+	}()
+
+	lifecycle.OnStop("admin-server", func(ctx context.Context) error {
+		return server.Shutdown(ctx)
+	}, lifecycle.WithPriority(lifecycle.PriorityClient))
+}
+
+// configDump dump all settings with sensitive values masked
+func (t *serverImpl) configDump(c echo.Context) error {
+	return c.JSON(http.StatusOK, maskSettings(t.options.Config.AllSettings()))
+}
+
+func maskSettings(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, it := range val {
+			if isSensitiveKey(k) {
+				m[k] = "******"
+				continue
+			}
+			m[k] = maskSettings(it)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, 0, len(val))
+		for _, it := range val {
+			list = append(list, maskSettings(it))
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, it := range sensitiveConfigKeys {
+		if strings.Contains(key, it) {
+			return true
+		}
+	}
+	return false
+}
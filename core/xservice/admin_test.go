@@ -0,0 +1,39 @@
+package xservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminIntranetOnly(t *testing.T) {
+	server := &serverImpl{options: &Options{Config: viper.New()}}
+	server.initAdmin()
+
+	request := func(remoteAddr string, header http.Header) int {
+		req := httptest.NewRequest(http.MethodGet, "/config", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		server.admin.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("127.0.0.1:1234", nil))
+	assert.Equal(t, http.StatusOK, request("10.1.2.3:1234", nil))
+	assert.Equal(t, http.StatusForbidden, request("8.8.8.8:1234", nil))
+
+	// spoofed forwarded headers from public address
+	assert.Equal(t, http.StatusForbidden, request("8.8.8.8:1234", http.Header{
+		echo.HeaderXForwardedFor: {"10.0.0.1"},
+	}))
+	assert.Equal(t, http.StatusForbidden, request("8.8.8.8:1234", http.Header{
+		echo.HeaderXRealIP: {"127.0.0.1"},
+	}))
+}
@@ -3,22 +3,21 @@ package xservice
 import (
 	"context"
 	"fmt"
-	"os"
+	"net"
 	"strings"
 	"sync"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
-	resolver "go.etcd.io/etcd/client/v3/naming/resolver"
-	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	gresolver "google.golang.org/grpc/resolver"
 
-	"github.com/xinpianchang/xservice/core"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 	"github.com/xinpianchang/xservice/pkg/log"
-	"github.com/xinpianchang/xservice/pkg/signalx"
+	"github.com/xinpianchang/xservice/pkg/registry"
 )
 
 // Client is the client for xservice
@@ -40,21 +39,18 @@ func newClient(opts *Options) Client {
 		conn:    make(map[string]*grpc.ClientConn, 128),
 	}
 
-	if os.Getenv(core.EnvEtcd) != "" {
-		var err error
-		client.resolver, err = resolver.NewBuilder(serviceEtcdClient())
-		if err != nil {
-			log.Fatal("endpoints manager", zap.Error(err))
-		}
+	if opts.Registry != nil {
+		client.resolver = registry.NewResolverBuilder(opts.Registry)
 	}
 
-	signalx.AddShutdownHook(func(os.Signal) {
+	lifecycle.OnStop("grpc-client", func(context.Context) error {
 		client.connMutex.Lock()
 		defer client.connMutex.Unlock()
 		for _, c := range client.conn {
 			_ = c.Close()
 		}
-	})
+		return nil
+	}, lifecycle.WithPriority(lifecycle.PriorityClient))
 
 	return client
 }
@@ -76,9 +72,15 @@ func (t *clientImpl) GrpcClientConn(ctx context.Context, service string, desc *g
 		return c, nil
 	}
 
+	direct := len(endpoint) > 0 && endpoint[0] != ""
+	target := ""
+	if direct {
+		target = endpoint[0]
+	}
+
 	options := make([]grpc.DialOption, 0, 8)
 	options = append(options,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(t.transportCredentials(target)),
 		grpc.WithBlock(),
 		// refer: https://github.com/grpc/grpc-go/blob/master/examples/features/load_balancing/client/main.go#L76
 		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin":{}}]}`),
@@ -98,7 +100,7 @@ func (t *clientImpl) GrpcClientConn(ctx context.Context, service string, desc *g
 	ctx, cancel := context.WithTimeout(ctx, t.options.GrpcClientDialTimeout)
 	defer cancel()
 
-	if len(endpoint) > 0 && endpoint[0] != "" {
+	if direct {
 		c, err := grpc.DialContext(ctx, endpoint[0], options...)
 		if err != nil {
 			return nil, err
@@ -109,11 +111,11 @@ func (t *clientImpl) GrpcClientConn(ctx context.Context, service string, desc *g
 		return c, nil
 	}
 
-	if os.Getenv(core.EnvEtcd) == "" {
-		log.Fatal("etcd not configured")
+	if t.resolver == nil {
+		log.Fatal("registry not configured")
 	}
 
-	target := fmt.Sprint("etcd:///", serviceKeyPrefix(service, desc))
+	target = fmt.Sprint(registry.Scheme, ":///", registry.ServiceName(service, desc.ServiceName))
 	options = append(options, grpc.WithResolvers(t.resolver))
 	c, err := grpc.DialContext(ctx, target, options...)
 	if err != nil {
@@ -125,6 +127,22 @@ func (t *clientImpl) GrpcClientConn(ctx context.Context, service string, desc *g
 	return c, nil
 }
 
+// transportCredentials credentials of dial, peers are dialed with tls if configured, including explicit endpoint
+// which is verified by its host, unless plaintext direct dial is opted in by WithGrpcClientPlaintextDirect
+func (t *clientImpl) transportCredentials(endpoint string) credentials.TransportCredentials {
+	if t.options.tls == nil || (endpoint != "" && t.options.GrpcClientPlaintextDirect) {
+		return insecure.NewCredentials()
+	}
+
+	config := t.options.tls.ClientConfig()
+	if endpoint != "" && config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(endpoint); err == nil {
+			config.ServerName = host
+		}
+	}
+	return credentials.NewTLS(config)
+}
+
 func (t *clientImpl) fastGetGrpcClient(key string) grpc.ClientConnInterface {
 	t.connMutex.RLock()
 	defer t.connMutex.RUnlock()
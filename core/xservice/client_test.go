@@ -0,0 +1,27 @@
+package xservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xinpianchang/xservice/pkg/tlsx"
+)
+
+func TestClientTransportCredentials(t *testing.T) {
+	client := &clientImpl{options: &Options{}}
+	assert.Equal(t, "insecure", client.transportCredentials("").Info().SecurityProtocol)
+	assert.Equal(t, "insecure", client.transportCredentials("10.0.0.1:5000").Info().SecurityProtocol)
+
+	// explicit endpoint is dialed with tls and verified by its host
+	client.options.tls = &tlsx.Reloader{}
+	assert.Equal(t, "tls", client.transportCredentials("").Info().SecurityProtocol)
+	info := client.transportCredentials("hello.internal:5000").Info()
+	assert.Equal(t, "tls", info.SecurityProtocol)
+	assert.Equal(t, "hello.internal", info.ServerName)
+
+	// plaintext only if opted in
+	client.options.GrpcClientPlaintextDirect = true
+	assert.Equal(t, "insecure", client.transportCredentials("10.0.0.1:5000").Info().SecurityProtocol)
+	assert.Equal(t, "tls", client.transportCredentials("").Info().SecurityProtocol)
+}
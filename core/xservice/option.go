@@ -18,6 +18,8 @@ import (
 	"github.com/xinpianchang/xservice/pkg/config"
 	"github.com/xinpianchang/xservice/pkg/gormx"
 	"github.com/xinpianchang/xservice/pkg/netx"
+	"github.com/xinpianchang/xservice/pkg/registry"
+	"github.com/xinpianchang/xservice/pkg/tlsx"
 )
 
 // Options for xservice core option
@@ -32,8 +34,13 @@ type Options struct {
 	GrpcServerEnableReflection bool
 	GrpcClientDialOptions      []grpc.DialOption
 	GrpcClientDialTimeout      time.Duration
+	GrpcClientPlaintextDirect  bool
 	SentryOptions              sentry.ClientOptions
 	EchoTracingSkipper         middleware.Skipper
+	Registry                   registry.Registry
+	TLSConfig                  tlsx.Config
+
+	tls *tlsx.Reloader
 }
 
 // Option for option config
@@ -105,6 +112,14 @@ func WithGrpcClientDialOptions(options ...grpc.DialOption) Option {
 	}
 }
 
+// WithGrpcClientPlaintextDirect dial explicit endpoints in plaintext even if tls configured,
+// e.g. peers outside of the service mesh which do not serve tls
+func WithGrpcClientPlaintextDirect() Option {
+	return func(o *Options) {
+		o.GrpcClientPlaintextDirect = true
+	}
+}
+
 // WithGrpcClientDialTimeout set client dial timeout
 // default 2 seconds
 func WithGrpcClientDialTimeout(timeout time.Duration) Option {
@@ -127,6 +142,21 @@ func WithEchoTracingSkipper(skipper middleware.Skipper) Option {
 	}
 }
 
+// WithRegistry set service registry for register & discovery,
+// default use etcd registry if env XSERVICE_ETCD configured
+func WithRegistry(r registry.Registry) Option {
+	return func(o *Options) {
+		o.Registry = r
+	}
+}
+
+// WithTLSConfig set tls config for server & client, default load from config key http.tls
+func WithTLSConfig(cfg tlsx.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = cfg
+	}
+}
+
 func loadOptions(options ...Option) *Options {
 	opts := new(Options)
 
@@ -162,6 +192,24 @@ func loadOptions(options ...Option) *Options {
 		opts.loadConfig()
 	}
 
+	if !opts.TLSConfig.Enabled() && opts.Config.IsSet(core.ConfigServiceTLS) {
+		if err := opts.Config.UnmarshalKey(core.ConfigServiceTLS, &opts.TLSConfig); err != nil {
+			log.Fatal("read tls config", zap.Error(err))
+		}
+	}
+
+	if opts.TLSConfig.Enabled() {
+		reloader, err := tlsx.NewReloader(opts.TLSConfig)
+		if err != nil {
+			log.Fatal("load tls certificate", zap.Error(err))
+		}
+		opts.tls = reloader
+	}
+
+	if opts.Registry == nil && os.Getenv(core.EnvEtcd) != "" {
+		opts.Registry = registry.NewEtcd(serviceEtcdClient())
+	}
+
 	// env addvice addr, high priority
 	if envAdvertisedAddr := os.Getenv(core.EnvAdvertisedAddr); envAdvertisedAddr != "" {
 		opts.Config.SetDefault(core.ConfigServiceAdvertisedAddr, envAdvertisedAddr)
@@ -2,6 +2,7 @@ package xservice
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -22,16 +23,16 @@ import (
 	"github.com/labstack/echo/v4"
 	echomd "github.com/labstack/echo/v4/middleware"
 	"github.com/opentracing/opentracing-go"
-	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/soheilhy/cmux"
-	clientv3 "go.etcd.io/etcd/client/v3"
-	"go.etcd.io/etcd/client/v3/naming/endpoints"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/health"
+	grpchealth "google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
@@ -40,7 +41,10 @@ import (
 	"github.com/xinpianchang/xservice/core/middleware"
 	"github.com/xinpianchang/xservice/pkg/echox"
 	"github.com/xinpianchang/xservice/pkg/grpcx"
+	"github.com/xinpianchang/xservice/pkg/health"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 	"github.com/xinpianchang/xservice/pkg/log"
+	"github.com/xinpianchang/xservice/pkg/registry"
 	"github.com/xinpianchang/xservice/pkg/signalx"
 	"github.com/xinpianchang/xservice/pkg/tracingx"
 )
@@ -71,8 +75,10 @@ type serverImpl struct {
 	grpcGateway  *gwrt.ServeMux
 	echo         *echo.Echo
 	grpc         *grpc.Server
+	grpcHealth   *grpchealth.Server
 	grpcServices []*grpcService
 	httpHandler  http.Handler
+	admin        *echo.Echo
 }
 
 func newServer(opts *Options) Server {
@@ -84,6 +90,10 @@ func newServer(opts *Options) Server {
 	server.initEcho()
 	server.initGrpc()
 
+	if server.adminEnabled() {
+		server.initAdmin()
+	}
+
 	return server
 }
 
@@ -97,6 +107,11 @@ func (t *serverImpl) Serve() error {
 
 	log.Debug("serve", zap.String("address", address))
 
+	if report := lifecycle.Default().Start(context.Background()); report.Err() != nil {
+		logLifecycleReport(report)
+		log.Fatal("lifecycle start", zap.Error(report.Err()))
+	}
+
 	upg, err := tableflip.New(tableflip.Options{
 		UpgradeTimeout: time.Minute,
 	})
@@ -113,21 +128,47 @@ func (t *serverImpl) Serve() error {
 	}
 	defer ln.Close()
 
-	mux := cmux.New(ln)
+	handler := t.httpHandler
+	var grpcL, httpL net.Listener
+	var mux cmux.CMux
+
+	if t.options.tls != nil {
+		// both HTTP/1 and gRPC over TLS, HTTP/2 clients (e.g. browsers) negotiate h2 via ALPN,
+		// so gRPC is matched by content-type and other HTTP/2 requests served as h2c after TLS termination
+		mux = cmux.New(tls.NewListener(ln, t.options.tls.ServerConfig()))
+		grpcL = mux.MatchWithWriters(cmux.HTTP2MatchHeaderFieldPrefixSendSettings("content-type", "application/grpc"))
+		httpL = mux.Match(cmux.Any())
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	} else {
+		mux = cmux.New(ln)
+		grpcL = mux.Match(cmux.HTTP2())
+		httpL = mux.Match(cmux.HTTP1Fast())
+	}
 	defer mux.Close()
-
-	grpcL := mux.Match(cmux.HTTP2())
 	defer grpcL.Close()
-
-	httpL := mux.Match(cmux.HTTP1Fast())
 	defer httpL.Close()
 
 	if len(t.grpcServices) > 0 {
 		go t.serveGrpc(grpcL)
+
+		lifecycle.OnStop("grpc-server", func(ctx context.Context) error {
+			done := make(chan struct{})
+			go func() {
+				t.grpc.GracefulStop()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				t.grpc.Stop()
+				return ctx.Err()
+			}
+		}, lifecycle.WithPriority(lifecycle.PriorityServer), lifecycle.WithTimeout(time.Minute))
 	}
 
 	server := http.Server{
-		Handler:           t.httpHandler,
+		Handler:           handler,
 		ReadHeaderTimeout: time.Second * 30,
 		IdleTimeout:       time.Minute * 1,
 	}
@@ -144,25 +185,41 @@ func (t *serverImpl) Serve() error {
 		_ = mux.Serve()
 	}()
 
+	// readiness down while draining
+	lifecycle.OnStop("health", func(context.Context) error {
+		health.Default().SetDraining(true)
+		return nil
+	}, lifecycle.WithPriority(lifecycle.PriorityRegistry))
+
+	// stop http server before grpc server, since grpc gateway proxy to grpc server
+	lifecycle.OnStop("http-server", func(ctx context.Context) error {
+		return server.Shutdown(ctx)
+	}, lifecycle.WithPriority(lifecycle.PriorityServer), lifecycle.WithTimeout(time.Minute))
+
+	lifecycle.OnStop("sentry", func(context.Context) error {
+		sentry.Flush(time.Second * 2)
+		return nil
+	}, lifecycle.WithPriority(lifecycle.PriorityTracing))
+
+	if t.admin != nil {
+		t.serveAdmin(upg)
+	}
+
 	if err = upg.Ready(); err != nil {
 		log.Fatal("ready", zap.Error(err))
 	}
 
 	// all ready
-	t.registerGrpcServiceEtcd()
+	t.registerGrpcService()
 
-	signalx.AddShutdownHook(func(os.Signal) {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-		defer cancel()
-		_ = server.Shutdown(ctx)
-		t.grpc.GracefulStop()
-		sentry.Flush(time.Second * 2)
-		log.Info("shutdown", zap.Int("pid", os.Getpid()))
-	})
+	if report := lifecycle.Default().Ready(context.Background()); report.Err() != nil {
+		logLifecycleReport(report)
+	}
 
 	<-upg.Exit()
 
-	signalx.Shutdown()
+	logLifecycleReport(signalx.ShutdownWithReport())
+	log.Info("shutdown", zap.Int("pid", os.Getpid()))
 
 	return nil
 }
@@ -207,8 +264,13 @@ func (t *serverImpl) initEcho() {
 	e.Use(middleware.Prometheus(strings.ReplaceAll(t.options.Name, "-", "_"), subsystem))
 	echox.ConfigValidator(e)
 
-	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
-	e.Group("/debug/*", middleware.Pprof())
+	// served by admin server if enabled
+	if !t.adminEnabled() {
+		e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+		e.Group("/debug/*", middleware.Pprof())
+	}
+	e.GET("/healthz", health.LivenessHandler())
+	e.GET("/readyz", health.ReadinessHandler())
 
 	t.echo = e
 }
@@ -247,9 +309,8 @@ func (t *serverImpl) initGrpc() {
 
 	t.grpc = g
 
-	healthServer := health.NewServer()
-	healthServer.SetServingStatus(t.options.Name, healthpb.HealthCheckResponse_SERVING)
-	healthpb.RegisterHealthServer(g, healthServer)
+	t.grpcHealth = grpchealth.NewServer()
+	healthpb.RegisterHealthServer(g, t.grpcHealth)
 
 	t.grpcGateway = gwrt.NewServeMux(
 		gwrt.WithRoutingErrorHandler(
@@ -345,6 +406,8 @@ func (t *serverImpl) serveGrpc(ln net.Listener) {
 	}
 	grpc_prometheus.Register(t.grpc)
 
+	t.watchGrpcHealth()
+
 	go func() {
 		_ = t.grpc.Serve(ln)
 	}()
@@ -353,7 +416,7 @@ func (t *serverImpl) serveGrpc(ln net.Listener) {
 	grpcClientConn, err := grpc.DialContext(
 		context.Background(),
 		address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(t.selfDialCredentials()),
 		grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(
 			grpc_opentracing.StreamClientInterceptor(),
 			grpc_prometheus.StreamClientInterceptor,
@@ -380,100 +443,76 @@ func (t *serverImpl) serveGrpc(ln net.Listener) {
 	}
 }
 
-// registerGrpcServiceEtcd
-// refer: https://etcd.io/docs/v3.5/dev-guide/grpc_naming/
-func (t *serverImpl) registerGrpcServiceEtcd() {
+// selfDialCredentials returns transport credentials for grpc gateway dial to self
+func (t *serverImpl) selfDialCredentials() credentials.TransportCredentials {
+	if t.options.tls == nil {
+		return insecure.NewCredentials()
+	}
+
+	// dial to self via listen address, which may not match certificate host
+	return credentials.NewTLS(t.options.tls.SelfClientConfig())
+}
+
+// registerGrpcService register grpc services to registry
+func (t *serverImpl) registerGrpcService() {
 	if len(t.grpcServices) == 0 {
 		return
 	}
 
-	if os.Getenv(core.EnvEtcd) == "" {
-		log.Info("etcd not configured, service register ignored")
+	if t.options.Registry == nil {
+		log.Info("registry not configured, service register ignored")
 		return
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	go t.doRegisterGrpcServiceEtcd(ctx)
-
-	signalx.AddShutdownHook(func(s os.Signal) {
-		cancel()
-		// deregister
-		log.Debug("deregister service")
-		client := serviceEtcdClient()
-		em, _ := endpoints.NewManager(client, core.ServiceRegisterKeyPrefix)
+	endpoint := registry.Endpoint{
+		ID:   registry.InstanceID(),
+		Addr: t.options.Config.GetString(core.ConfigServiceAdvertisedAddr),
+	}
 
-		for _, service := range t.grpcServices {
-			_ = em.DeleteEndpoint(context.Background(), serviceKey(os.Getenv(core.EnvServiceName), service.Desc))
-		}
+	health.Register("registry", func(ctx context.Context) error {
+		_, err := t.options.Registry.Resolve(ctx, registry.ServiceName(t.options.Name, t.grpcServices[0].Desc.ServiceName))
+		return err
 	})
-}
 
-func (t *serverImpl) doRegisterGrpcServiceEtcd(ctx context.Context) {
-	l := log.Named("registerGrpcServiceEtcd")
-	defer func() {
-		if x := recover(); x != nil {
-			l.Error("recover", zap.Any("err", x))
-			sentry.CaptureException(errors.WithStack(errors.New(fmt.Sprint(x))))
-
-			time.Sleep(time.Second * 10)
-			go t.doRegisterGrpcServiceEtcd(ctx)
+	for _, service := range t.grpcServices {
+		name := registry.ServiceName(t.options.Name, service.Desc.ServiceName)
+		ep := endpoint
+		ep.Metadata = service.Desc.Metadata
+		if err := t.options.Registry.Register(context.Background(), name, ep); err != nil {
+			log.Error("register service", zap.String("service", name), zap.Error(err))
 		}
-	}()
-
-	client := serviceEtcdClient()
-
-	ticker := time.NewTicker(time.Second * 5)
-	defer ticker.Stop()
-
-	ttl := int64(10) // seconds
-
-	em, _ := endpoints.NewManager(client, core.ServiceRegisterKeyPrefix)
-
-	var (
-		id    clientv3.LeaseID = 0
-		lease clientv3.Lease   = clientv3.NewLease(client)
-
-		addr = t.options.Config.GetString(core.ConfigServiceAdvertisedAddr)
-	)
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if id == 0 {
-				leaseRsp, err := lease.Grant(context.Background(), ttl)
-				if err != nil {
-					l.Error("lease.Grant", zap.Error(err))
-					continue
-				}
-				id = leaseRsp.ID
-
-				for _, service := range t.grpcServices {
-					key := serviceKey(os.Getenv(core.EnvServiceName), service.Desc)
-					endpoint := endpoints.Endpoint{
-						Addr:     addr,
-						Metadata: service.Desc.Metadata,
-					}
-
-					ll := l.With(zap.String("service", key))
-					err = em.AddEndpoint(context.Background(), key, endpoint, clientv3.WithLease(id))
-					if err != nil {
-						ll.Error("kv.Put", zap.Error(err))
-					}
-				}
-			} else {
-				_, err := lease.KeepAliveOnce(context.Background(), id)
-				if err != nil {
-					id = 0
-				}
+	lifecycle.OnStop("registry", func(ctx context.Context) error {
+		log.Debug("deregister service")
+		var err error
+		for _, service := range t.grpcServices {
+			name := registry.ServiceName(t.options.Name, service.Desc.ServiceName)
+			if e := t.options.Registry.Deregister(ctx, name, endpoint); e != nil {
+				err = e
 			}
 		}
+		return err
+	}, lifecycle.WithPriority(lifecycle.PriorityRegistry))
+}
 
-		// wait next loop
-		<-ticker.C
+// watchGrpcHealth update grpc health serving status by dependency checkers,
+// all services will be NOT_SERVING during shutdown drain
+func (t *serverImpl) watchGrpcHealth() {
+	services := make([]string, 0, len(t.grpcServices)+2)
+	services = append(services, "", t.options.Name)
+	for _, service := range t.grpcServices {
+		services = append(services, service.Desc.ServiceName)
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go health.Default().WatchGrpc(ctx, t.grpcHealth, services, time.Second*5)
+
+	lifecycle.OnStop("grpc-health", func(context.Context) error {
+		cancel()
+		t.grpcHealth.Shutdown()
+		return nil
+	}, lifecycle.WithPriority(lifecycle.PriorityRegistry))
 }
 
 type echoContext struct {
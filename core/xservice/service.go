@@ -1,7 +1,6 @@
 package xservice
 
 import (
-	"fmt"
 	"os"
 	"strings"
 	"sync"
@@ -10,27 +9,11 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"google.golang.org/grpc"
 
 	"github.com/xinpianchang/xservice/core"
 	"github.com/xinpianchang/xservice/pkg/log"
 )
 
-// serviceKey get full service key
-func serviceKey(serviceName string, desc *grpc.ServiceDesc) string {
-	host, _ := os.Hostname()
-	pid := os.Getpid()
-	if host == "" {
-		host = "unknown-host"
-	}
-	return fmt.Sprint(serviceKeyPrefix(serviceName, desc), "/", host, "-pid-", pid)
-}
-
-// serviceKeyPrefix get service key prefix
-func serviceKeyPrefix(serviceName string, desc *grpc.ServiceDesc) string {
-	return fmt.Sprint(core.ServiceRegisterKeyPrefix, "/", serviceName, "/", desc.ServiceName)
-}
-
 var (
 	_etcdClient     *clientv3.Client
 	_etcdClientOnce sync.Once
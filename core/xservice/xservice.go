@@ -1,6 +1,7 @@
 package xservice
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
@@ -12,6 +13,7 @@ import (
 	"github.com/xinpianchang/xservice/core"
 	"github.com/xinpianchang/xservice/pkg/gormx"
 	"github.com/xinpianchang/xservice/pkg/kafkax"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 	"github.com/xinpianchang/xservice/pkg/log"
 	"github.com/xinpianchang/xservice/pkg/redisx"
 	"github.com/xinpianchang/xservice/pkg/tracingx"
@@ -24,6 +26,18 @@ type Service interface {
 	Client() Client
 	Server() Server
 	String() string
+
+	// Lifecycle get lifecycle manager, which shared with builtin packages
+	Lifecycle() *lifecycle.Lifecycle
+
+	// OnStart add hook which run before server listen, server will exit if hook failed
+	OnStart(name string, fn lifecycle.Hook, opts ...lifecycle.HookOption)
+
+	// OnReady add hook which run after server listened and service registered
+	OnReady(name string, fn lifecycle.Hook, opts ...lifecycle.HookOption)
+
+	// OnStop add hook which run on shutdown, ordered by priority with timeout
+	OnStop(name string, fn lifecycle.Hook, opts ...lifecycle.HookOption)
 }
 
 // serviceImpl is xservice service implementation
@@ -78,8 +92,28 @@ func (t *serviceImpl) String() string {
 	return fmt.Sprint(t.Name(), "/", t.options.Version, " - ", t.options.Description)
 }
 
+// Lifecycle get lifecycle manager
+func (t *serviceImpl) Lifecycle() *lifecycle.Lifecycle {
+	return lifecycle.Default()
+}
+
+// OnStart add start hook
+func (t *serviceImpl) OnStart(name string, fn lifecycle.Hook, opts ...lifecycle.HookOption) {
+	t.Lifecycle().OnStart(name, fn, opts...)
+}
+
+// OnReady add ready hook
+func (t *serviceImpl) OnReady(name string, fn lifecycle.Hook, opts ...lifecycle.HookOption) {
+	t.Lifecycle().OnReady(name, fn, opts...)
+}
+
+// OnStop add stop hook
+func (t *serviceImpl) OnStop(name string, fn lifecycle.Hook, opts ...lifecycle.HookOption) {
+	t.Lifecycle().OnStop(name, fn, opts...)
+}
+
 func (t *serviceImpl) init() {
-	if err := agent.Listen(agent.Options{}); err != nil {
+	if err := agent.Listen(agent.Options{Addr: t.options.Config.GetString(core.ConfigAdminGopsAddr)}); err != nil {
 		log.Fatal("agent", zap.Error(err))
 	}
 
@@ -89,6 +123,15 @@ func (t *serviceImpl) init() {
 
 	tracingx.Config(t.options.Config)
 
+	if t.options.tls != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		go t.options.tls.Watch(ctx)
+		lifecycle.OnStop("tls-reloader", func(context.Context) error {
+			cancel()
+			return nil
+		})
+	}
+
 	if t.options.SentryOptions.Dsn != "" {
 		err := sentry.Init(t.options.SentryOptions)
 		if err != nil {
@@ -114,3 +157,22 @@ func (t *serviceImpl) init() {
 
 	t.client = newClient(t.options)
 }
+
+// logLifecycleReport log hook results of lifecycle phase
+func logLifecycleReport(report *lifecycle.Report) {
+	for _, r := range report.Results {
+		l := log.With(
+			zap.String("phase", string(report.Phase)),
+			zap.String("hook", r.Name),
+			zap.Duration("elapsed", r.Elapsed),
+		)
+		switch {
+		case r.Skipped:
+			l.Warn("lifecycle hook skipped")
+		case r.Err != nil:
+			l.Error("lifecycle hook failed", zap.Error(r.Err))
+		default:
+			l.Debug("lifecycle hook done")
+		}
+	}
+}
@@ -0,0 +1,393 @@
+// Package cachex read-through cache with singleflight, optional in-process LRU in front of redis,
+// and cross instances local cache invalidation via redis pub/sub
+package cachex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+	"github.com/xinpianchang/xservice/pkg/redisx"
+)
+
+const (
+	DefaultTTL = time.Minute * 10 // ttl used when ttl <= 0
+
+	defaultLocalTTL    = time.Minute
+	defaultLoadTimeout = time.Second * 10
+
+	flagValue    byte = 1
+	flagNotFound byte = 2
+)
+
+var (
+	// ErrNotFound returned by loader to indicate value not exists, which is cached if negative ttl set
+	ErrNotFound = errors.New("cachex: not found")
+
+	// ErrMiss cache missed
+	ErrMiss = errors.New("cachex: miss")
+)
+
+// Loader load value when cache missed, return ErrNotFound if value not exists
+type Loader func(ctx context.Context) (interface{}, error)
+
+// Option cache option
+type Option func(*options)
+
+type options struct {
+	codec       Codec
+	localSize   int
+	localTTL    time.Duration
+	negativeTTL time.Duration
+	jitter      float64
+	loadTimeout time.Duration
+}
+
+// WithCodec set value codec, default JSON
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithLocal enable in-process LRU cache in front of redis with max size entries,
+// local entry expired after min(ttl, localTTL) (default 1 minute), and invalidated across instances via redis pub/sub
+func WithLocal(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.localSize = size
+		o.localTTL = ttl
+	}
+}
+
+// WithNegativeTTL cache ErrNotFound of loader with ttl, default 0 (disabled)
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithJitter add random [0, ttl*jitter) to ttl to avoid entries expired at the same time, default 0.1
+func WithJitter(jitter float64) Option {
+	return func(o *options) {
+		o.jitter = jitter
+	}
+}
+
+// WithLoadTimeout timeout of loader, default 10s, loader is shared by concurrent callers of the same key,
+// so it runs with context detached from caller's cancellation
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.loadTimeout = timeout
+	}
+}
+
+// Cache read-through cache
+type Cache struct {
+	client   redis.UniversalClient
+	name     string
+	channel  string
+	instance string
+	options  options
+	group    singleflight.Group
+	local    *lru.Cache
+	pubsub   *redis.PubSub
+}
+
+type localEntry struct {
+	data     []byte
+	expireAt time.Time
+}
+
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+// New create cache with redis client, name is used as key namespace, keys are prefixed by redisx.Key
+func New(client redis.UniversalClient, name string, opts ...Option) *Cache {
+	t := &Cache{
+		client:   client,
+		name:     name,
+		channel:  redisx.Key(client, "cachex", name),
+		instance: instanceID(),
+		options: options{
+			codec:       JSON,
+			jitter:      0.1,
+			loadTimeout: defaultLoadTimeout,
+		},
+	}
+	for _, opt := range opts {
+		opt(&t.options)
+	}
+
+	if t.options.localSize > 0 {
+		if t.options.localTTL <= 0 {
+			t.options.localTTL = defaultLocalTTL
+		}
+		t.local, _ = lru.New(t.options.localSize)
+		t.subscribe()
+	}
+
+	return t
+}
+
+// GetOrLoad get value of key into value (pointer), load with loader and cache with ttl if missed,
+// concurrent loading of the same key is de-duplicated, caller returns on ctx done without canceling the shared loading
+func (t *Cache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, value interface{}, loader Loader) error {
+	k := t.key(key)
+
+	data, err := t.get(ctx, k)
+	if err != nil && err != ErrMiss {
+		log.For(ctx).Warn("cachex get", zap.String("key", k), zap.Error(err))
+	}
+
+	if err != nil {
+		ch := t.group.DoChan(k, func() (interface{}, error) {
+			ctx, cancel := context.WithTimeout(detachedContext{ctx}, t.options.loadTimeout)
+			defer cancel()
+			return t.load(ctx, k, ttl, loader)
+		})
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r := <-ch:
+			if r.Err != nil {
+				return r.Err
+			}
+			data = r.Val.([]byte)
+		}
+	}
+
+	return t.decode(data, value)
+}
+
+// Get get value of key into value (pointer), returns ErrMiss if not cached,
+// or ErrNotFound if not found result cached
+func (t *Cache) Get(ctx context.Context, key string, value interface{}) error {
+	data, err := t.get(ctx, t.key(key))
+	if err != nil {
+		return err
+	}
+	return t.decode(data, value)
+}
+
+// Set set value of key with ttl, local caches of other instances are invalidated
+func (t *Cache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := t.encode(value)
+	if err != nil {
+		return err
+	}
+
+	k := t.key(key)
+	if err = t.set(ctx, k, data, ttl); err != nil {
+		return err
+	}
+	t.publish(ctx, k)
+	return nil
+}
+
+// Delete delete keys, local caches of other instances are invalidated
+func (t *Cache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ks := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ks = append(ks, t.key(key))
+	}
+
+	if t.local != nil {
+		for _, k := range ks {
+			t.local.Remove(k)
+		}
+	}
+
+	if err := t.client.Del(ctx, ks...).Err(); err != nil {
+		return err
+	}
+	t.publish(ctx, ks...)
+	return nil
+}
+
+// Close stop subscribing invalidation
+func (t *Cache) Close() error {
+	if t.pubsub != nil {
+		return t.pubsub.Close()
+	}
+	return nil
+}
+
+func (t *Cache) key(key string) string {
+	return redisx.Key(t.client, t.name, key)
+}
+
+func (t *Cache) get(ctx context.Context, k string) ([]byte, error) {
+	if t.local != nil {
+		if v, ok := t.local.Get(k); ok {
+			entry := v.(*localEntry)
+			if time.Now().Before(entry.expireAt) {
+				return entry.data, nil
+			}
+			t.local.Remove(k)
+		}
+	}
+
+	data, err := t.client.Get(ctx, k).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t.setLocal(k, data, t.options.localTTL)
+	return data, nil
+}
+
+func (t *Cache) load(ctx context.Context, k string, ttl time.Duration, loader Loader) ([]byte, error) {
+	v, err := loader(ctx)
+	if err == ErrNotFound && t.options.negativeTTL > 0 {
+		data := []byte{flagNotFound}
+		if e := t.set(ctx, k, data, t.options.negativeTTL); e != nil {
+			log.For(ctx).Warn("cachex set", zap.String("key", k), zap.Error(e))
+		}
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := t.encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if e := t.set(ctx, k, data, ttl); e != nil {
+		log.For(ctx).Warn("cachex set", zap.String("key", k), zap.Error(e))
+	}
+	return data, nil
+}
+
+func (t *Cache) set(ctx context.Context, k string, data []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if t.options.jitter > 0 {
+		ttl += time.Duration(mrand.Int63n(int64(float64(ttl)*t.options.jitter) + 1))
+	}
+
+	localTTL := ttl
+	if t.options.localTTL > 0 && t.options.localTTL < localTTL {
+		localTTL = t.options.localTTL
+	}
+	t.setLocal(k, data, localTTL)
+
+	return t.client.Set(ctx, k, data, ttl).Err()
+}
+
+func (t *Cache) setLocal(k string, data []byte, ttl time.Duration) {
+	if t.local == nil || ttl <= 0 {
+		return
+	}
+	t.local.Add(k, &localEntry{data: data, expireAt: time.Now().Add(ttl)})
+}
+
+func (t *Cache) encode(value interface{}) ([]byte, error) {
+	data, err := t.options.codec.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "cachex encode")
+	}
+	return append([]byte{flagValue}, data...), nil
+}
+
+func (t *Cache) decode(data []byte, value interface{}) error {
+	if len(data) == 0 {
+		return errors.New("cachex decode, empty data")
+	}
+	switch data[0] {
+	case flagNotFound:
+		return ErrNotFound
+	case flagValue:
+		return errors.Wrap(t.options.codec.Unmarshal(data[1:], value), "cachex decode")
+	default:
+		return errors.Errorf("cachex decode, unknown flag: %v", data[0])
+	}
+}
+
+func (t *Cache) publish(ctx context.Context, keys ...string) {
+	data, _ := json.Marshal(&invalidation{Origin: t.instance, Keys: keys})
+	if err := t.client.Publish(ctx, t.channel, data).Err(); err != nil {
+		log.For(ctx).Warn("cachex publish invalidation", zap.String("channel", t.channel), zap.Error(err))
+	}
+}
+
+func (t *Cache) subscribe() {
+	t.pubsub = t.client.Subscribe(context.Background(), t.channel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := t.pubsub.Receive(ctx); err != nil {
+		log.Warn("cachex subscribe invalidation", zap.String("channel", t.channel), zap.Error(err))
+	}
+
+	go func() {
+		for msg := range t.pubsub.Channel() {
+			var it invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &it); err != nil {
+				log.Warn("cachex invalidation", zap.String("payload", msg.Payload), zap.Error(err))
+				continue
+			}
+			if it.Origin == t.instance {
+				continue
+			}
+			for _, k := range it.Keys {
+				t.local.Remove(k)
+			}
+		}
+	}()
+
+	lifecycle.OnStop(fmt.Sprint("cachex:", t.name), func(context.Context) error {
+		return t.Close()
+	}, lifecycle.WithPriority(lifecycle.PriorityResource))
+}
+
+func instanceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// detachedContext keeps values (e.g. tracing span) of parent without deadline & cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (t detachedContext) Value(key interface{}) interface{} {
+	return t.parent.Value(key)
+}
@@ -0,0 +1,186 @@
+package cachex
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	ID   int    `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+func newClient(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return s, client
+}
+
+func TestGetOrLoad(t *testing.T) {
+	s, client := newClient(t)
+	cache := New(client, "user")
+
+	var loads int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(time.Millisecond * 20)
+		return &user{ID: 1, Name: "hello"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var u user
+			assert.NoError(t, cache.GetOrLoad(context.Background(), "1", time.Minute, &u, loader))
+			assert.Equal(t, "hello", u.Name)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// cached in redis with jitter ttl
+	assert.True(t, s.Exists("user:1"))
+	ttl := s.TTL("user:1")
+	assert.True(t, ttl >= time.Minute && ttl <= time.Minute+time.Second*6, ttl)
+
+	var u user
+	assert.NoError(t, cache.GetOrLoad(context.Background(), "1", time.Minute, &u, loader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// loader error is not cached
+	loadErr := errors.New("load failed")
+	err := cache.GetOrLoad(context.Background(), "2", time.Minute, &u, func(ctx context.Context) (interface{}, error) {
+		return nil, loadErr
+	})
+	assert.Equal(t, loadErr, err)
+	assert.False(t, s.Exists("user:2"))
+}
+
+func TestGetOrLoadCanceled(t *testing.T) {
+	_, client := newClient(t)
+	cache := New(client, "canceled")
+
+	var loads int32
+	started, release := make(chan struct{}), make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		close(started)
+		select {
+		case <-release:
+			return &user{ID: 1, Name: "hello"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// first caller canceled while loading
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		var u user
+		first <- cache.GetOrLoad(ctx, "1", time.Minute, &u, loader)
+	}()
+	<-started
+
+	second := make(chan error, 1)
+	var u user
+	go func() {
+		second <- cache.GetOrLoad(context.Background(), "1", time.Minute, &u, loader)
+	}()
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-first)
+
+	// waiter is not affected
+	close(release)
+	require.NoError(t, <-second)
+	assert.Equal(t, "hello", u.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// loader timeout
+	cache = New(client, "timeout", WithLoadTimeout(time.Millisecond*10))
+	err := cache.GetOrLoad(context.Background(), "1", time.Minute, &u, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestNegativeCache(t *testing.T) {
+	s, client := newClient(t)
+	cache := New(client, "user", WithNegativeTTL(time.Second*30))
+
+	var loads int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, ErrNotFound
+	}
+
+	var u user
+	assert.Equal(t, ErrNotFound, cache.GetOrLoad(context.Background(), "404", time.Minute, &u, loader))
+	assert.Equal(t, ErrNotFound, cache.GetOrLoad(context.Background(), "404", time.Minute, &u, loader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	assert.True(t, s.TTL("user:404") <= time.Second*33)
+
+	assert.Equal(t, ErrMiss, cache.Get(context.Background(), "405", &u))
+}
+
+func TestCodec(t *testing.T) {
+	_, client := newClient(t)
+
+	cache := New(client, "msgpack", WithCodec(Msgpack))
+	assert.NoError(t, cache.Set(context.Background(), "1", &user{ID: 1, Name: "msgpack"}, time.Minute))
+	var u user
+	assert.NoError(t, cache.Get(context.Background(), "1", &u))
+	assert.Equal(t, user{ID: 1, Name: "msgpack"}, u)
+
+	cache = New(client, "protobuf", WithCodec(Protobuf))
+	assert.NoError(t, cache.Set(context.Background(), "1", wrapperspb.String("protobuf"), time.Minute))
+	var v wrapperspb.StringValue
+	assert.NoError(t, cache.Get(context.Background(), "1", &v))
+	assert.Equal(t, "protobuf", v.Value)
+	assert.Error(t, cache.Set(context.Background(), "2", &u, time.Minute))
+}
+
+func TestLocalInvalidation(t *testing.T) {
+	s, client := newClient(t)
+
+	a := New(client, "user", WithLocal(100, time.Minute))
+	defer a.Close()
+	b := New(client, "user", WithLocal(100, time.Minute))
+	defer b.Close()
+
+	require.NoError(t, a.Set(context.Background(), "1", &user{ID: 1, Name: "v1"}, time.Minute))
+
+	var u user
+	require.NoError(t, b.Get(context.Background(), "1", &u))
+	assert.Equal(t, "v1", u.Name)
+
+	// served by local cache even if redis changed
+	s.Del("user:1")
+	require.NoError(t, b.Get(context.Background(), "1", &u))
+	assert.Equal(t, "v1", u.Name)
+
+	require.NoError(t, a.Set(context.Background(), "1", &user{ID: 1, Name: "v2"}, time.Minute))
+	assert.Eventually(t, func() bool {
+		return b.Get(context.Background(), "1", &u) == nil && u.Name == "v2"
+	}, time.Second, time.Millisecond*10)
+
+	require.NoError(t, a.Delete(context.Background(), "1"))
+	assert.Eventually(t, func() bool {
+		return b.Get(context.Background(), "1", &u) == ErrMiss
+	}, time.Second, time.Millisecond*10)
+}
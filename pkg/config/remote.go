@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -27,9 +28,27 @@ func (t *remoteConfig) Get(rp viper.RemoteProvider) (io.Reader, error) {
 	return t.get()
 }
 
+// Watch blocks until config changed, returns the changed config, as expected by viper WatchRemoteConfig
 func (t *remoteConfig) Watch(rp viper.RemoteProvider) (io.Reader, error) {
 	t.RemoteProvider = rp
-	return t.get()
+
+	client, err := t.client()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	for res := range client.Watch(context.Background(), t.Path()) {
+		if err := res.Err(); err != nil {
+			return nil, err
+		}
+		for _, event := range res.Events {
+			if event.Type == mvccpb.PUT {
+				return bytes.NewReader(event.Kv.Value), nil
+			}
+		}
+	}
+	return nil, errors.New("watch config closed")
 }
 
 func (t *remoteConfig) WatchChannel(rp viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool) {
@@ -1,19 +1,21 @@
 package cronx
 
 import (
-	"os"
+	"context"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 	"github.com/xinpianchang/xservice/pkg/log"
-	"github.com/xinpianchang/xservice/pkg/signalx"
 )
 
 const (
-	SpecManual              = "@manual"    // specification for manual
+	SpecManual              = "@manual"    // specification for manual, job is not scheduled but triggered by Trigger
 	SpecMonthly             = "@monthly"   // spec monthly
 	SpecWeekly              = "@weekly"    // spec weekly
 	SpecHourly              = "@hourly"    // spec hourly
@@ -28,50 +30,172 @@ const (
 )
 
 var (
-	c    = cron.New(cron.WithSeconds())
-	once sync.Once
+	// ErrJobNotFound job of name not found
+	ErrJobNotFound = errors.New("cronx: job not found")
+
+	// ErrStopped cron is stopping on shutdown, job could not be triggered
+	ErrStopped = errors.New("cronx: stopped")
+
+	parser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	c      = cron.New(cron.WithParser(parser))
+	once   sync.Once
+
+	jobs   = make(map[string]*job)
+	jobsMu sync.RWMutex
+
+	// ctx of jobs, canceled on shutdown
+	jobsCtx, jobsCancel = context.WithCancel(context.Background())
+	manualRuns          sync.WaitGroup
+	manualMu            sync.Mutex
+	stopping            bool
 )
 
 func start() {
 	once.Do(func() {
-		signalx.AddShutdownHook(func(os.Signal) {
-			log.Info("shutdown cron")
-			c.Stop()
-		})
+		lifecycle.OnStop("cron", stop, lifecycle.WithPriority(lifecycle.PriorityWorker))
 		go c.Start()
 	})
 }
 
-func Add(name string, spec string, fn func()) {
-	var (
-		id  cron.EntryID
-		err error
-	)
+// stop stop scheduling and cancel context of running jobs, then wait them returned until ctx done
+func stop(ctx context.Context) error {
+	log.Info("shutdown cron")
 
-	getEntry := func() cron.Entry {
-		return c.Entry(id)
+	manualMu.Lock()
+	stopping = true
+	manualMu.Unlock()
+
+	scheduled := c.Stop()
+	jobsCancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		<-scheduled.Done()
+		manualRuns.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	id, err = c.AddFunc(spec, func() {
-		l := log.Named(name)
-		start := time.Now()
-		defer func() {
-			if x := recover(); x != nil {
-				l.Error("panic", zap.Any("err", x))
-				return
-			}
-			entry := getEntry()
-			l.Info("done", zap.Duration("escape", time.Since(start)), zap.Time("next", entry.Next))
-		}()
+// Add add job, which runs on every instance by default, see options for singleton execution across instances
+func Add(name string, spec string, fn func(), opts ...Option) {
+	AddJob(name, spec, func(context.Context) error {
 		fn()
-	})
+		return nil
+	}, opts...)
+}
+
+// AddJob add job with context, which is canceled on shutdown or timeout (see WithTimeout),
+// job is failed if error returned or panic.
+//
+// job of SpecManual is not scheduled, but could be triggered by Trigger or admin handler
+func AddJob(name string, spec string, fn func(ctx context.Context) error, opts ...Option) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	if _, ok := jobs[name]; ok {
+		log.Error("cron add, duplicated name", zap.String("name", name))
+		return
+	}
+
+	j := newJob(name, spec, fn, opts...)
 
-	if err != nil {
-		log.Error("cron add", zap.Error(err))
+	if spec != SpecManual {
+		id, err := c.AddFunc(spec, func() {
+			j.run(c.Entry(j.entryID).Prev, false)
+		})
+		if err != nil {
+			log.Error("cron add", zap.String("name", name), zap.Error(err))
+			return
+		}
+		j.entryID = id
+
+		entry := c.Entry(id)
+		log.Debug("cron add", zap.String("name", name), zap.String("spec", spec), zap.Time("next", entry.Schedule.Next(time.Now())))
 	}
 
-	entry := getEntry()
-	log.Debug("cron add", zap.String("name", name), zap.String("spec", spec), zap.Time("next", entry.Schedule.Next(time.Now())))
+	jobs[name] = j
 
 	start()
 }
+
+// Trigger run job of name now in background, regardless of paused and singleton options except skip-if-running,
+// ErrStopped returned on shutdown
+func Trigger(name string) error {
+	j, ok := getJob(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	manualMu.Lock()
+	if stopping {
+		manualMu.Unlock()
+		return ErrStopped
+	}
+	manualRuns.Add(1)
+	manualMu.Unlock()
+
+	go func() {
+		defer manualRuns.Done()
+		j.run(time.Now(), true)
+	}()
+
+	return nil
+}
+
+// Pause pause scheduled runs of job
+func Pause(name string) error {
+	j, ok := getJob(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+	j.setPaused(true)
+	return nil
+}
+
+// Resume resume scheduled runs of paused job
+func Resume(name string) error {
+	j, ok := getJob(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+	j.setPaused(false)
+	return nil
+}
+
+// Jobs returns info of all jobs, sorted by name
+func Jobs() []*JobInfo {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+
+	list := make([]*JobInfo, 0, len(jobs))
+	for _, j := range jobs {
+		list = append(list, j.info())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// GetJob returns info of job
+func GetJob(name string) (*JobInfo, error) {
+	j, ok := getJob(name)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return j.info(), nil
+}
+
+func getJob(name string) (*job, bool) {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+	j, ok := jobs[name]
+	return j, ok
+}
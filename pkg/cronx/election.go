@@ -0,0 +1,110 @@
+package cronx
+
+import (
+	"context"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/core"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	electionSessionTTL = 10 // seconds
+	electionRetry      = time.Second * 3
+)
+
+// elector campaign for leadership of job in background until stopped
+type elector struct {
+	client *clientv3.Client
+	key    string
+	leader int32
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newElector(client *clientv3.Client, name string) *elector {
+	service := os.Getenv(core.EnvServiceName)
+	if service == "" {
+		service = core.DefaultServiceName
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &elector{
+		client: client,
+		key:    path.Join(core.ServiceElectionKeyPrefix, service, "cronx", name),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go t.run(ctx)
+
+	lifecycle.OnStop("cron-election:"+name, func(ctx context.Context) error {
+		t.cancel()
+		select {
+		case <-t.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, lifecycle.WithPriority(lifecycle.PriorityWorker))
+
+	return t
+}
+
+// isLeader whether current instance is leader
+func (t *elector) isLeader() bool {
+	return atomic.LoadInt32(&t.leader) == 1
+}
+
+func (t *elector) run(ctx context.Context) {
+	defer close(t.done)
+
+	for {
+		if err := t.campaign(ctx); err != nil {
+			log.Warn("cron election", zap.String("key", t.key), zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(electionRetry):
+		}
+	}
+}
+
+// campaign block until session lost or ctx done
+func (t *elector) campaign(ctx context.Context) error {
+	session, err := concurrency.NewSession(t.client, concurrency.WithTTL(electionSessionTTL), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	hostname, _ := os.Hostname()
+	election := concurrency.NewElection(session, t.key)
+	if err = election.Campaign(ctx, hostname); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&t.leader, 1)
+	log.Info("cron election, elected", zap.String("key", t.key))
+	defer atomic.StoreInt32(&t.leader, 0)
+
+	select {
+	case <-session.Done():
+		log.Warn("cron election, session lost", zap.String("key", t.key))
+		return nil
+	case <-ctx.Done():
+		resignCtx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		return election.Resign(resignCtx)
+	}
+}
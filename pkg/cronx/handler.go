@@ -0,0 +1,43 @@
+package cronx
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterHandler register admin handlers of jobs to group, e.g. /cron, which should be intranet only
+//
+//	GET  /            list jobs with next run time
+//	POST /:name/trigger  run job now
+//	POST /:name/pause    pause scheduled runs
+//	POST /:name/resume   resume scheduled runs
+func RegisterHandler(g *echo.Group) {
+	g.GET("", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, Jobs())
+	})
+	g.POST("/:name/trigger", jobHandler(Trigger, http.StatusAccepted))
+	g.POST("/:name/pause", jobHandler(Pause, http.StatusOK))
+	g.POST("/:name/resume", jobHandler(Resume, http.StatusOK))
+}
+
+func jobHandler(action func(name string) error, code int) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if err := action(name); err != nil {
+			if err == ErrJobNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			if err == ErrStopped {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			}
+			return err
+		}
+
+		info, err := GetJob(name)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return c.JSON(code, info)
+	}
+}
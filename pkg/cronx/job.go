@@ -0,0 +1,233 @@
+package cronx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+	"github.com/xinpianchang/xservice/pkg/redisx"
+)
+
+const (
+	defaultLockTTL = time.Second * 10
+)
+
+// JobInfo job status
+type JobInfo struct {
+	Name         string        `json:"name"`
+	Spec         string        `json:"spec"`
+	Paused       bool          `json:"paused"`
+	Running      int32         `json:"running"` // number of running runs in this instance
+	Next         time.Time     `json:"next"`
+	Prev         time.Time     `json:"prev"`
+	LastRun      time.Time     `json:"lastRun"`
+	LastSuccess  time.Time     `json:"lastSuccess"`
+	LastDuration time.Duration `json:"lastDuration"`
+	LastError    string        `json:"lastError,omitempty"`
+}
+
+type job struct {
+	name    string
+	spec    string
+	fn      func(ctx context.Context) error
+	opts    options
+	every   time.Duration // interval of @every spec, ticks are relative to start of each instance
+	entryID cron.EntryID
+	paused  int32
+	running int32
+	elector *elector
+
+	mu           sync.Mutex
+	lastRun      time.Time
+	lastSuccess  time.Time
+	lastDuration time.Duration
+	lastError    string
+}
+
+func newJob(name, spec string, fn func(ctx context.Context) error, opts ...Option) *job {
+	t := &job{name: name, spec: spec, fn: fn}
+	for _, opt := range opts {
+		opt(&t.opts)
+	}
+
+	if spec != SpecManual {
+		if schedule, err := parser.Parse(spec); err == nil {
+			if s, ok := schedule.(cron.ConstantDelaySchedule); ok {
+				t.every = s.Delay
+			}
+		}
+	}
+
+	if t.opts.redis != nil && t.opts.lockTTL <= 0 {
+		t.opts.lockTTL = defaultLockTTL
+	}
+	// lock of @every tick is held through the interval, so later ticks of other instances in the same interval are skipped
+	if t.opts.redis != nil && t.opts.lockTTL < t.every {
+		t.opts.lockTTL = t.every
+	}
+
+	if t.opts.etcd != nil {
+		t.elector = newElector(t.opts.etcd, name)
+	}
+
+	return t
+}
+
+// run job of scheduled tick, manual run ignores paused & singleton options except skip-if-running
+func (t *job) run(tick time.Time, manual bool) {
+	l := log.Named(t.name)
+
+	if !manual && atomic.LoadInt32(&t.paused) == 1 {
+		l.Debug("skip, paused")
+		return
+	}
+
+	if !t.acquire(tick, manual) {
+		return
+	}
+	defer t.release()
+
+	ctx, cancel := context.WithCancel(jobsCtx)
+	if t.opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(jobsCtx, t.opts.timeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	err := t.call(ctx)
+	duration := time.Since(start)
+
+	observeRun(t.name, start, duration, err)
+	t.mu.Lock()
+	t.lastRun, t.lastDuration = start, duration
+	if err == nil {
+		t.lastSuccess, t.lastError = start, ""
+	} else {
+		t.lastError = err.Error()
+	}
+	t.mu.Unlock()
+
+	if err != nil {
+		l.Error("failed", zap.Duration("escape", duration), zap.Bool("manual", manual), zap.Error(err))
+		return
+	}
+
+	next, _ := t.schedule()
+	l.Info("done", zap.Duration("escape", duration), zap.Bool("manual", manual), zap.Time("next", next))
+}
+
+func (t *job) call(ctx context.Context) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("panic: %v", x)
+		}
+	}()
+	return t.fn(ctx)
+}
+
+// acquire check whether job of scheduled tick should run in this instance, release must be called if true
+func (t *job) acquire(tick time.Time, manual bool) bool {
+	l := log.Named(t.name)
+
+	if t.opts.skipIfRunning && !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+		l.Debug("skip, still running")
+		return false
+	}
+	if !t.opts.skipIfRunning {
+		atomic.AddInt32(&t.running, 1)
+	}
+
+	if manual {
+		return true
+	}
+
+	if t.elector != nil && !t.elector.isLeader() {
+		l.Debug("skip, not leader")
+		t.release()
+		return false
+	}
+
+	if t.opts.redis != nil {
+		ok, err := t.lockTick(tick)
+		if err != nil {
+			l.Error("skip, lock", zap.Error(err))
+		} else if !ok {
+			l.Debug("skip, locked by others", zap.Time("tick", tick))
+		}
+		if !ok {
+			t.release()
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t *job) release() {
+	atomic.AddInt32(&t.running, -1)
+}
+
+// lockTick lock scheduled tick, the lock is not released after run, but expires after ttl.
+// tick of @every spec is truncated to the interval, as instances are started at different time
+func (t *job) lockTick(tick time.Time) (bool, error) {
+	if tick.IsZero() {
+		tick = time.Now().Truncate(time.Second)
+	}
+	if t.every > 0 {
+		tick = tick.Truncate(t.every)
+	}
+
+	hostname, _ := os.Hostname()
+	key := redisx.Key(t.opts.redis, "cronx", t.name, fmt.Sprint(tick.Unix()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	return t.opts.redis.SetNX(ctx, key, hostname, t.opts.lockTTL).Result()
+}
+
+func (t *job) setPaused(paused bool) {
+	var v int32
+	if paused {
+		v = 1
+	}
+	atomic.StoreInt32(&t.paused, v)
+	log.Named(t.name).Info("cron paused", zap.Bool("paused", paused))
+}
+
+func (t *job) info() *JobInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info := &JobInfo{
+		Name:         t.name,
+		Spec:         t.spec,
+		Paused:       atomic.LoadInt32(&t.paused) == 1,
+		Running:      atomic.LoadInt32(&t.running),
+		LastRun:      t.lastRun,
+		LastSuccess:  t.lastSuccess,
+		LastDuration: t.lastDuration,
+		LastError:    t.lastError,
+	}
+	info.Next, info.Prev = t.schedule()
+	return info
+}
+
+// schedule returns next & prev run time, next is calculated if cron not started yet
+func (t *job) schedule() (next, prev time.Time) {
+	if t.entryID == 0 {
+		return
+	}
+	entry := c.Entry(t.entryID)
+	if entry.Next.IsZero() && entry.Schedule != nil {
+		return entry.Schedule.Next(time.Now()), entry.Prev
+	}
+	return entry.Next, entry.Prev
+}
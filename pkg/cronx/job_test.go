@@ -0,0 +1,189 @@
+package cronx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noop(context.Context) error {
+	return nil
+}
+
+func TestJobSkipIfRunning(t *testing.T) {
+	j := newJob("skip", SpecManual, noop, WithSkipIfRunning())
+	tick := time.Now()
+
+	assert.True(t, j.acquire(tick, false))
+	assert.False(t, j.acquire(tick, false))
+	j.release()
+	assert.True(t, j.acquire(tick, false))
+
+	j = newJob("overlap", SpecManual, noop)
+	assert.True(t, j.acquire(tick, false))
+	assert.True(t, j.acquire(tick, false))
+	assert.Equal(t, int32(2), j.info().Running)
+}
+
+func TestJobRedisLock(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	a := newJob("lock", SpecManual, noop, WithRedisLock(client, 0))
+	b := newJob("lock", SpecManual, noop, WithRedisLock(client, 0))
+	tick := time.Unix(1000, 0)
+
+	assert.True(t, a.acquire(tick, false))
+	a.release()
+	assert.False(t, b.acquire(tick, false), "tick already run by a")
+	assert.True(t, b.acquire(tick.Add(time.Minute), false))
+	b.release()
+	assert.True(t, b.acquire(tick, true), "manual run ignores lock")
+
+	assert.Equal(t, defaultLockTTL, s.TTL("cronx:lock:1000"))
+
+	s.Close()
+	assert.False(t, a.acquire(tick.Add(time.Hour), false), "skip if redis failed")
+}
+
+func TestJobRedisLockEvery(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	// instances started at different time, ticks of @every are offset
+	a := newJob("every", SpecEveryMinutes, noop, WithRedisLock(client, 0))
+	b := newJob("every", SpecEveryMinutes, noop, WithRedisLock(client, 0))
+	tick := time.Unix(6000, 0)
+
+	assert.True(t, a.acquire(tick.Add(time.Second*20), false))
+	a.release()
+	assert.False(t, b.acquire(tick.Add(time.Second*50), false), "same interval already run by a")
+	assert.True(t, b.acquire(tick.Add(time.Second*70), false))
+	b.release()
+	assert.False(t, a.acquire(tick.Add(time.Second*80), false), "same interval already run by b")
+
+	assert.Equal(t, time.Minute, s.TTL("cronx:every:6000"))
+}
+
+func TestJobRun(t *testing.T) {
+	calls := 0
+	j := newJob("run", SpecManual, func(ctx context.Context) error {
+		calls++
+		switch calls {
+		case 1:
+			return nil
+		case 2:
+			return errors.New("failed")
+		case 3:
+			panic("panic")
+		default:
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	}, WithTimeout(time.Millisecond*10))
+
+	j.run(time.Now(), false)
+	assert.Empty(t, j.info().LastError)
+	assert.False(t, j.info().LastSuccess.IsZero())
+
+	j.run(time.Now(), false)
+	assert.Equal(t, "failed", j.info().LastError)
+
+	j.run(time.Now(), false)
+	assert.Equal(t, "panic: panic", j.info().LastError)
+
+	j.run(time.Now(), false)
+	assert.Equal(t, context.DeadlineExceeded.Error(), j.info().LastError)
+
+	j.setPaused(true)
+	j.run(time.Now(), false)
+	assert.Equal(t, 4, calls)
+	j.run(time.Now(), true)
+	assert.Equal(t, 5, calls)
+
+	assert.Equal(t, float64(5), testutil.ToFloat64(jobRuns.WithLabelValues("run")))
+	assert.Equal(t, float64(4), testutil.ToFloat64(jobFailures.WithLabelValues("run")))
+	assert.NotZero(t, testutil.ToFloat64(jobLastSuccess.WithLabelValues("run")))
+}
+
+func TestHandler(t *testing.T) {
+	done := make(chan struct{}, 1)
+	AddJob("handler", SpecManual, func(ctx context.Context) error {
+		done <- struct{}{}
+		return nil
+	})
+	Add("handler-scheduled", SpecDaily, func() {})
+
+	e := echo.New()
+	RegisterHandler(e.Group("/cron"))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/cron")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"handler"`)
+
+	info, err := GetJob("handler-scheduled")
+	require.NoError(t, err)
+	assert.True(t, info.Next.After(time.Now()))
+
+	assert.Equal(t, http.StatusAccepted, do(http.MethodPost, "/cron/handler/trigger").Code)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not triggered")
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/cron/handler-scheduled/pause").Code)
+	info, _ = GetJob("handler-scheduled")
+	assert.True(t, info.Paused)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/cron/handler-scheduled/resume").Code)
+	info, _ = GetJob("handler-scheduled")
+	assert.False(t, info.Paused)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/cron/missing/trigger").Code)
+}
+
+// TestStop stops the global cron, must be the last test
+func TestStop(t *testing.T) {
+	running := make(chan struct{})
+	canceled := make(chan struct{})
+	AddJob("stop", SpecManual, func(ctx context.Context) error {
+		close(running)
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	})
+	require.NoError(t, Trigger("stop"))
+	<-running
+
+	// context of running job is canceled first, instead of after stop timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	start := time.Now()
+	assert.NoError(t, stop(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+	select {
+	case <-canceled:
+	default:
+		t.Error("job not canceled")
+	}
+
+	assert.Equal(t, ErrStopped, Trigger("stop"))
+}
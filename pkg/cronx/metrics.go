@@ -0,0 +1,53 @@
+package cronx
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	metricsNamespace = "cron"
+)
+
+var (
+	jobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "job",
+		Name:      "runs_total",
+		Help:      "Number of job runs",
+	}, []string{"name"})
+
+	jobFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "job",
+		Name:      "failures_total",
+		Help:      "Number of failed job runs, error returned or panic",
+	}, []string{"name"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "job",
+		Name:      "duration_seconds",
+		Help:      "Job run duration",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600},
+	}, []string{"name"})
+
+	jobLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "job",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix timestamp of last successful job run",
+	}, []string{"name"})
+)
+
+func observeRun(name string, start time.Time, duration time.Duration, err error) {
+	jobRuns.WithLabelValues(name).Inc()
+	jobDuration.WithLabelValues(name).Observe(duration.Seconds())
+	if err != nil {
+		jobFailures.WithLabelValues(name).Inc()
+		return
+	}
+	jobLastSuccess.WithLabelValues(name).Set(float64(start.Add(duration).Unix()))
+}
@@ -0,0 +1,50 @@
+package cronx
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type options struct {
+	skipIfRunning bool
+	redis         redis.UniversalClient
+	lockTTL       time.Duration
+	etcd          *clientv3.Client
+	timeout       time.Duration
+}
+
+// Option job option
+type Option func(*options)
+
+// WithSkipIfRunning skip tick if previous run of job is still running in this instance
+func WithSkipIfRunning() Option {
+	return func(o *options) {
+		o.skipIfRunning = true
+	}
+}
+
+// WithRedisLock run each scheduled tick on only one instance, by redis lock of tick which expires after ttl.
+// ttl should be greater than clock skew between instances, and less than interval of schedule, default 10s.
+// tick of @every spec is truncated to the interval and locked for at least the interval
+func WithRedisLock(client redis.UniversalClient, ttl time.Duration) Option {
+	return func(o *options) {
+		o.redis = client
+		o.lockTTL = ttl
+	}
+}
+
+// WithEtcdElection run job only on the leader instance, elected by etcd per job name of service
+func WithEtcdElection(client *clientv3.Client) Option {
+	return func(o *options) {
+		o.etcd = client
+	}
+}
+
+// WithTimeout cancel context of job after timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
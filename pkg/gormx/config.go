@@ -1,17 +1,21 @@
 package gormx
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	_ "gorm.io/datatypes"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 	gormopentracing "gorm.io/plugin/opentracing"
 
+	"github.com/xinpianchang/xservice/pkg/gormx/migrate"
+	"github.com/xinpianchang/xservice/pkg/health"
 	"github.com/xinpianchang/xservice/pkg/log"
 )
 
@@ -20,18 +24,30 @@ var (
 )
 
 type DbConfig struct {
-	Name                         string `yaml:"name"`
-	Uri                          string `yaml:"uri"`
-	MaxConn                      int    `yaml:"maxConn"`
-	MaxIdleConn                  int    `yaml:"maxIdleConn"`
-	ConnMaxLifetimeInMillisecond int    `yaml:"connMaxLifetimeInMillisecond"`
-	QueryFields                  bool   `yaml:"queryFields"`
-	CreateBatchSize              int    `yaml:"createBatchSize"`
+	Name                         string  `yaml:"name"`
+	Driver                       string  `yaml:"driver"` // mysql (default), postgres, sqlite, or registered by RegisterDriver
+	Uri                          string  `yaml:"uri"`
+	MaxConn                      int     `yaml:"maxConn"`
+	MaxIdleConn                  int     `yaml:"maxIdleConn"`
+	ConnMaxLifetimeInMillisecond int     `yaml:"connMaxLifetimeInMillisecond"`
+	QueryFields                  bool    `yaml:"queryFields"`
+	CreateBatchSize              int     `yaml:"createBatchSize"`
+	SlowThresholdInMillisecond   int     `yaml:"slowThresholdInMillisecond"` // log slow query at warn level with caller, default 200, disabled if negative
+	LogSampleRate                float64 `yaml:"logSampleRate"`              // sample rate of sql logs in (0, 1], default 1, errors & slow queries are always logged
+
+	// read replicas, read queries are routed to healthy replicas, see WithPrimary & UsePrimary
+	Replicas []string `yaml:"replicas"`
+	Policy   string   `yaml:"policy"` // replica policy: random (default), roundrobin
+
+	// schema migration, SQL files of dir and then Go migrations registered by migrate.Register are applied on startup,
+	// instances wait until the one holding lock finished
+	MigrateOnStartup bool   `yaml:"migrateOnStartup"`
+	MigrationDir     string `yaml:"migrationDir"` // default migrations/{name}, skipped if not exists
 }
 
 type ConfigureFn func(DbConfig) *gorm.DB
 
-// Config config db, default use mysql
+// Config config db, opened by driver of config if configureFn not specified
 func Config(v *viper.Viper, configureFn ...ConfigureFn) {
 	var cfg []DbConfig
 	if err := v.UnmarshalKey("database", &cfg); err != nil {
@@ -56,11 +72,19 @@ func Config(v *viper.Viper, configureFn ...ConfigureFn) {
 			c.CreateBatchSize = 1000
 		}
 
+		if c.SlowThresholdInMillisecond == 0 {
+			c.SlowThresholdInMillisecond = 200
+		}
+
+		if c.LogSampleRate <= 0 || c.LogSampleRate > 1 {
+			c.LogSampleRate = 1
+		}
+
 		var db *gorm.DB
 		if len(configureFn) > 0 && configureFn[0] != nil {
 			db = configureFn[0](c)
 		} else {
-			db = MySQLDbConfig(c)
+			db = OpenDbConfig(c)
 		}
 		if db == nil {
 			continue
@@ -68,13 +92,40 @@ func Config(v *viper.Viper, configureFn ...ConfigureFn) {
 		if err := db.Use(gormopentracing.New()); err != nil {
 			log.Error("apply db opentracing", zap.Error(err))
 		}
+		if err := db.Use(&metricsPlugin{name: c.Name}); err != nil {
+			log.Error("apply db metrics", zap.Error(err))
+		}
 		dbs[c.Name] = db
+
+		if c.MigrateOnStartup {
+			migrateOnStartup(db, c)
+		}
+
+		if sqlDB, err := db.DB(); err == nil {
+			health.Register(fmt.Sprint("database:", c.Name), sqlDB.PingContext)
+			dbStats.add(c.Name, sqlDB)
+		}
 	}
 }
 
 // MySQLDbConfig for mysql config
 func MySQLDbConfig(cfg DbConfig) *gorm.DB {
-	db, err := gorm.Open(mysql.Open(cfg.Uri), &gorm.Config{
+	cfg.Driver = DriverMySQL
+	return OpenDbConfig(cfg)
+}
+
+// OpenDbConfig open db by driver of config, with pool settings & sql logger & replicas
+func OpenDbConfig(cfg DbConfig) *gorm.DB {
+	if cfg.Driver == "" {
+		cfg.Driver = DriverMySQL
+	}
+
+	opener, ok := GetOpener(cfg.Driver)
+	if !ok {
+		log.Fatal("unsupported db driver", zap.String("name", cfg.Name), zap.String("driver", cfg.Driver))
+	}
+
+	db, err := gorm.Open(opener(cfg.Uri), &gorm.Config{
 		QueryFields:     cfg.QueryFields,
 		CreateBatchSize: cfg.CreateBatchSize,
 		NamingStrategy: schema.NamingStrategy{
@@ -91,21 +142,71 @@ func MySQLDbConfig(cfg DbConfig) *gorm.DB {
 		log.Fatal("get db failed", zap.Error(err))
 	}
 
-	sqlDB.SetMaxOpenConns(cfg.MaxConn)
-	sqlDB.SetMaxIdleConns(cfg.MaxIdleConn)
-	sqlDB.SetConnMaxLifetime(time.Millisecond * time.Duration(cfg.ConnMaxLifetimeInMillisecond))
+	configPool(sqlDB, cfg)
 
 	logger, _ := log.NewLogger(fmt.Sprint("sql-", cfg.Name, ".log"))
-	db.Logger = &dbLogger{logger: logger.Named(cfg.Name)}
+	db.Logger = &dbLogger{
+		logger:        logger.Named(cfg.Name),
+		slowThreshold: time.Millisecond * time.Duration(cfg.SlowThresholdInMillisecond),
+		sampleRate:    cfg.LogSampleRate,
+	}
 
 	err = sqlDB.Ping()
 	if err != nil {
 		log.Fatal("db ping failed", zap.Error(err))
 	}
 
+	if len(cfg.Replicas) > 0 {
+		err = useReplicas(db, cfg, replicaOpener(cfg.Driver, opener))
+		if err != nil {
+			log.Fatal("db replicas failed", zap.String("name", cfg.Name), zap.Error(err))
+		}
+	}
+
 	return db
 }
 
+// migrateOnStartup apply SQL migrations of dir and then registered Go migrations,
+// waits if others are migrating
+func migrateOnStartup(db *gorm.DB, cfg DbConfig) {
+	ctx := WithPrimary(context.Background())
+
+	dir := cfg.MigrationDir
+	if dir == "" {
+		dir = fmt.Sprint("migrations/", cfg.Name)
+	}
+
+	var migrations []*migrate.Migration
+	if _, err := os.Stat(dir); err == nil || cfg.MigrationDir != "" {
+		if migrations, err = migrate.LoadDir(dir); err != nil {
+			log.Fatal("load db migrations", zap.String("name", cfg.Name), zap.String("dir", dir), zap.Error(err))
+		}
+	}
+
+	for _, list := range [][]*migrate.Migration{migrations, migrate.Registered(cfg.Name)} {
+		if len(list) == 0 {
+			continue
+		}
+
+		m, err := migrate.New(db, list)
+		if err != nil {
+			log.Fatal("db migrations", zap.String("name", cfg.Name), zap.Error(err))
+		}
+
+		n, err := m.Up(ctx)
+		if err != nil {
+			log.Fatal("db migrate up", zap.String("name", cfg.Name), zap.Error(err))
+		}
+		log.Info("db migrated", zap.String("name", cfg.Name), zap.Bool("go", list[0].IsGo()), zap.Int("applied", n))
+	}
+}
+
+func configPool(sqlDB *sql.DB, cfg DbConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxConn)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConn)
+	sqlDB.SetConnMaxLifetime(time.Millisecond * time.Duration(cfg.ConnMaxLifetimeInMillisecond))
+}
+
 func Get(name string) *gorm.DB {
 	return dbs[name]
 }
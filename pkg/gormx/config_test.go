@@ -0,0 +1,100 @@
+package gormx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/xinpianchang/xservice/pkg/gormx/migrate"
+)
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+func TestConfigSQLite(t *testing.T) {
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "primary.db")
+	replica := filepath.Join(dir, "replica.db")
+
+	// replica has different data, to check which one is queried
+	for file, name := range map[string]string{primary: "primary", replica: "replica"} {
+		db, err := gorm.Open(drivers[DriverSQLite](file), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+		require.NoError(t, err)
+		require.NoError(t, db.AutoMigrate(&user{}))
+		require.NoError(t, db.Create(&user{ID: 1, Name: name}).Error)
+		sqlDB, _ := db.DB()
+		_ = sqlDB.Close()
+	}
+
+	v := viper.New()
+	v.Set("database", []map[string]interface{}{
+		{"name": "sqlite", "driver": "sqlite", "uri": filepath.Join(dir, "test.db")},
+		{"name": "replicas", "driver": "sqlite", "uri": primary, "replicas": []string{replica}},
+	})
+	Config(v)
+
+	db := Get("sqlite")
+	require.NotNil(t, db)
+	assert.Equal(t, "sqlite", db.Dialector.Name())
+	require.NoError(t, db.AutoMigrate(&user{}))
+	require.NoError(t, db.Create(&user{Name: "hello"}).Error)
+
+	var u user
+	require.NoError(t, db.First(&u).Error)
+	assert.Equal(t, "hello", u.Name)
+
+	db = Get("replicas")
+	ctx := context.Background()
+	name := func(db *gorm.DB) string {
+		var u user
+		require.NoError(t, db.First(&u, 1).Error)
+		return u.Name
+	}
+
+	assert.Equal(t, "replica", name(db.WithContext(ctx)))
+	assert.Equal(t, "primary", name(db.WithContext(WithPrimary(ctx))))
+	assert.Equal(t, "primary", name(UsePrimary(db)))
+
+	var raw string
+	require.NoError(t, db.Raw("SELECT name FROM user WHERE id = 1").Scan(&raw).Error)
+	assert.Equal(t, "replica", raw)
+
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		assert.Equal(t, "primary", name(tx))
+		return nil
+	}))
+
+	require.NoError(t, db.Model(&user{}).Where("id = 1").Update("name", "updated").Error)
+	assert.Equal(t, "updated", name(UsePrimary(db)))
+	assert.Equal(t, "replica", name(db))
+}
+
+func TestConfigMigrateOnStartup(t *testing.T) {
+	dir := t.TempDir()
+	migrations := filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(migrations, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(migrations, "1_add_user.up.sql"), []byte("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT);"), 0o644))
+
+	migrate.Register("migrated", &migrate.Migration{Version: "2", Name: "seed", Up: func(tx *gorm.DB) error {
+		return tx.Create(&user{ID: 1, Name: "seed"}).Error
+	}})
+
+	v := viper.New()
+	v.Set("database", []map[string]interface{}{
+		{"name": "migrated", "driver": "sqlite", "uri": filepath.Join(dir, "test.db"), "migrateOnStartup": true, "migrationDir": migrations},
+	})
+	Config(v)
+
+	var u user
+	require.NoError(t, Get("migrated").First(&u, 1).Error)
+	assert.Equal(t, "seed", u.Name)
+}
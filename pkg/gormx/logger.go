@@ -4,17 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
 
 	"github.com/xinpianchang/xservice/pkg/log"
 )
 
 type dbLogger struct {
-	logger log.Logger
+	logger        log.Logger
+	slowThreshold time.Duration // log slow query at warn level, disabled if not positive
+	sampleRate    float64       // sample rate of normal query logs in (0, 1), log all otherwise, errors & slow queries are always logged
 }
 
 func (t *dbLogger) LogMode(logger.LogLevel) logger.Interface {
@@ -34,12 +38,23 @@ func (t *dbLogger) Error(ctx context.Context, msg string, data ...interface{}) {
 }
 
 func (t *dbLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := t.slowThreshold > 0 && elapsed >= t.slowThreshold
+
+	if !failed && !slow && t.sampleRate > 0 && t.sampleRate < 1 && rand.Float64() >= t.sampleRate {
+		return
+	}
+
 	l := t.logger.For(ctx).CallerSkip(4)
 	sql, rows := fc()
-	l = l.With(zap.Duration("elapsed", time.Since(begin)), zap.Int64("rows", rows))
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	l = l.With(zap.Duration("elapsed", elapsed), zap.Int64("rows", rows))
+	switch {
+	case failed:
 		l.Warn(sql, zap.Error(err))
-	} else {
+	case slow:
+		l.Warn(sql, zap.Bool("slow", true), zap.Duration("threshold", t.slowThreshold), zap.String("caller", utils.FileWithLineNum()))
+	default:
 		l.Info(sql)
 	}
 }
@@ -0,0 +1,62 @@
+package gormx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/gorm"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+// fakeLogger records levels & fields of logs
+type fakeLogger struct {
+	levels []string
+	fields []zapcore.Field
+}
+
+func (t *fakeLogger) Named(string) log.Logger                 { return t }
+func (t *fakeLogger) Debug(string, ...zapcore.Field)          { t.levels = append(t.levels, "debug") }
+func (t *fakeLogger) Info(string, ...zapcore.Field)           { t.levels = append(t.levels, "info") }
+func (t *fakeLogger) Error(string, ...zapcore.Field)          { t.levels = append(t.levels, "error") }
+func (t *fakeLogger) Fatal(string, ...zapcore.Field)          { t.levels = append(t.levels, "fatal") }
+func (t *fakeLogger) With(fields ...zapcore.Field) log.Logger { return t }
+func (t *fakeLogger) For(context.Context) log.Logger          { return t }
+func (t *fakeLogger) CallerSkip(int) log.Logger               { return t }
+func (t *fakeLogger) Warn(_ string, fields ...zapcore.Field) {
+	t.levels = append(t.levels, "warn")
+	t.fields = fields
+}
+
+func TestDbLoggerTrace(t *testing.T) {
+	l := &fakeLogger{}
+	logger := &dbLogger{logger: l, slowThreshold: time.Millisecond * 100, sampleRate: 0.0001}
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+	ctx := context.Background()
+
+	// sampled out
+	for i := 0; i < 100; i++ {
+		logger.Trace(ctx, time.Now(), fc, nil)
+		logger.Trace(ctx, time.Now(), fc, gorm.ErrRecordNotFound)
+	}
+	assert.Len(t, l.levels, 0)
+
+	logger.Trace(ctx, time.Now(), fc, errors.New("failed"))
+	assert.Equal(t, []string{"warn"}, l.levels)
+
+	logger.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	assert.Equal(t, []string{"warn", "warn"}, l.levels)
+	assert.Equal(t, "slow", l.fields[0].Key)
+	assert.Equal(t, "caller", l.fields[2].Key)
+	assert.Contains(t, l.fields[2].String, "logger_test.go")
+
+	// log all if sample rate not set
+	l.levels = nil
+	logger = &dbLogger{logger: l}
+	logger.Trace(ctx, time.Now().Add(-time.Hour), fc, nil)
+	assert.Equal(t, []string{"info"}, l.levels)
+}
@@ -0,0 +1,186 @@
+package gormx
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+const (
+	metricsNamespace = "db"
+
+	statusCommit   = "commit"
+	statusRollback = "rollback"
+
+	metricsStartKey = "gormx:metrics_start"
+)
+
+var (
+	transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "transactions_total",
+		Help:      "Number of transactions by result",
+	}, []string{"name", "status"})
+
+	transactionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "transaction_duration_seconds",
+		Help:      "Transaction duration",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"name", "status"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_duration_seconds",
+		Help:      "Query duration by operation and table",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"name", "operation", "table"})
+
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_errors_total",
+		Help:      "Number of query errors by operation and table, record not found excluded",
+	}, []string{"name", "operation", "table"})
+
+	dbStats = newDBStatsCollector()
+)
+
+func init() {
+	prometheus.MustRegister(dbStats)
+}
+
+func observeTransaction(name, status string, duration time.Duration) {
+	transactions.WithLabelValues(name, status).Inc()
+	transactionDuration.WithLabelValues(name, status).Observe(duration.Seconds())
+}
+
+// metricsPlugin gorm plugin records query duration & errors
+type metricsPlugin struct {
+	name string
+}
+
+// Name implements gorm.Plugin
+func (t *metricsPlugin) Name() string {
+	return "gormx:metrics"
+}
+
+// Initialize implements gorm.Plugin
+func (t *metricsPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("*").Register("gormx:metrics_before", t.before),
+		cb.Create().After("*").Register("gormx:metrics_after", t.after("create")),
+		cb.Query().Before("*").Register("gormx:metrics_before", t.before),
+		cb.Query().After("*").Register("gormx:metrics_after", t.after("query")),
+		cb.Update().Before("*").Register("gormx:metrics_before", t.before),
+		cb.Update().After("*").Register("gormx:metrics_after", t.after("update")),
+		cb.Delete().Before("*").Register("gormx:metrics_before", t.before),
+		cb.Delete().After("*").Register("gormx:metrics_after", t.after("delete")),
+		cb.Row().Before("*").Register("gormx:metrics_before", t.before),
+		cb.Row().After("*").Register("gormx:metrics_after", t.after("row")),
+		cb.Raw().Before("*").Register("gormx:metrics_before", t.before),
+		cb.Raw().After("*").Register("gormx:metrics_after", t.after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *metricsPlugin) before(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (t *metricsPlugin) after(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		start, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		queryDuration.WithLabelValues(t.name, operation, table).Observe(time.Since(start.(time.Time)).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			queryErrors.WithLabelValues(t.name, operation, table).Inc()
+		}
+	}
+}
+
+// dbStatsCollector collects sql.DBStats of dbs
+type dbStatsCollector struct {
+	mu  sync.RWMutex
+	dbs map[string]*sql.DB
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func newDBStatsCollector() *dbStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "pool", name), help, []string{"name"}, nil)
+	}
+
+	return &dbStatsCollector{
+		dbs:               make(map[string]*sql.DB),
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections"),
+		open:              desc("open_connections", "Number of established connections, in use and idle"),
+		inUse:             desc("in_use_connections", "Number of connections currently in use"),
+		idle:              desc("idle_connections", "Number of idle connections"),
+		waitCount:         desc("wait_count_total", "Number of connections waited for"),
+		waitDuration:      desc("wait_duration_seconds_total", "Total time blocked waiting for a new connection"),
+		maxIdleClosed:     desc("max_idle_closed_total", "Number of connections closed due to max idle connections"),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "Number of connections closed due to max idle time"),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Number of connections closed due to max lifetime"),
+	}
+}
+
+func (t *dbStatsCollector) add(name string, db *sql.DB) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dbs[name] = db
+}
+
+// Describe implements prometheus.Collector
+func (t *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.maxOpen
+	ch <- t.open
+	ch <- t.inUse
+	ch <- t.idle
+	ch <- t.waitCount
+	ch <- t.waitDuration
+	ch <- t.maxIdleClosed
+	ch <- t.maxIdleTimeClosed
+	ch <- t.maxLifetimeClosed
+}
+
+// Collect implements prometheus.Collector
+func (t *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for name, db := range t.dbs {
+		stats := db.Stats()
+		ch <- prometheus.MustNewConstMetric(t.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(t.open, prometheus.GaugeValue, float64(stats.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(t.inUse, prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(t.idle, prometheus.GaugeValue, float64(stats.Idle), name)
+		ch <- prometheus.MustNewConstMetric(t.waitCount, prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(t.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(t.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed), name)
+		ch <- prometheus.MustNewConstMetric(t.maxIdleTimeClosed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), name)
+		ch <- prometheus.MustNewConstMetric(t.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), name)
+	}
+}
@@ -0,0 +1,45 @@
+package gormx
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMetrics(t *testing.T) {
+	v := viper.New()
+	v.Set("database", []map[string]interface{}{
+		{"name": "metrics", "driver": "sqlite", "uri": filepath.Join(t.TempDir(), "metrics.db")},
+	})
+	Config(v)
+
+	db := Get("metrics")
+	require.NoError(t, db.AutoMigrate(&user{}))
+	require.NoError(t, db.Create(&user{Name: "hello"}).Error)
+
+	var u user
+	require.NoError(t, db.First(&u).Error)
+	assert.Equal(t, gorm.ErrRecordNotFound, db.First(&u, 100).Error)
+	assert.Error(t, db.Exec("UPDATE missing SET name = 1").Error)
+
+	var m dto.Metric
+	require.NoError(t, queryDuration.WithLabelValues("metrics", "query", "user").(prometheus.Histogram).Write(&m))
+	assert.Equal(t, uint64(2), m.GetHistogram().GetSampleCount())
+	assert.Equal(t, float64(0), testutil.ToFloat64(queryErrors.WithLabelValues("metrics", "query", "user")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(queryErrors.WithLabelValues("metrics", "raw", "")))
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	collector := newDBStatsCollector()
+	collector.add("metrics", sqlDB)
+	assert.Equal(t, 9, testutil.CollectAndCount(collector, "db_pool_max_open_connections", "db_pool_open_connections",
+		"db_pool_in_use_connections", "db_pool_idle_connections", "db_pool_wait_count_total", "db_pool_wait_duration_seconds_total",
+		"db_pool_max_idle_closed_total", "db_pool_max_idle_time_closed_total", "db_pool_max_lifetime_closed_total"))
+}
@@ -0,0 +1,603 @@
+// Package migrate versioned schema migration for gorm, migrations are up/down SQL files or Go functions,
+// applied migrations are recorded with checksum in table, and locked so only one instance migrates.
+//
+// SQL file name format: {version}_{name}.up.sql & {version}_{name}.down.sql, e.g. 20221017120000_create_user.up.sql,
+// statements are separated by semicolon at end of line.
+//
+// Go migrations are never mixed with SQL migrations in the same table, they are recorded in DefaultGoTable,
+// since SQL files are also managed by `xservice migrate` which knows nothing about Go migrations.
+//
+// DDL is not transactional in some databases (e.g. mysql), so a migration is recorded as dirty before run,
+// and stays dirty if failed, which must be fixed manually and then resolved by Force.
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	DefaultTable   = "schema_migrations"    // default table of SQL migration records, lock table is suffixed with _lock
+	DefaultGoTable = "schema_migrations_go" // default table of Go migration records
+
+	checksumGo = "go" // checksum of Go migrations
+)
+
+var (
+	lockRefresh = time.Second * 10 // lock is refreshed by holder periodically
+	lockTTL     = lockRefresh * 6  // lock not refreshed within ttl is considered stale, e.g. process crashed
+	lockRetry   = time.Second
+
+	// ErrChecksumMismatch applied migration changed
+	ErrChecksumMismatch = errors.New("migrate: checksum mismatch")
+
+	// ErrDirty migration failed, schema must be fixed manually and then resolved by Force
+	ErrDirty = errors.New("migrate: dirty")
+
+	// ErrOutOfOrder pending migration is lower than the highest applied one, see WithOutOfOrder
+	ErrOutOfOrder = errors.New("migrate: out of order")
+
+	// ErrMixed Go & SQL migrations in the same table
+	ErrMixed = errors.New("migrate: Go & SQL migrations mixed in the same table")
+
+	// ErrLockTimeout lock held by others after timeout
+	ErrLockTimeout = errors.New("migrate: lock timeout")
+
+	// ErrLockLost lock not refreshed or taken by others while migrating, migrating stopped
+	ErrLockLost = errors.New("migrate: lock lost")
+)
+
+// Migration versioned migration, SQL or Go
+type Migration struct {
+	Version string // sortable version, e.g. timestamp 20221017120000
+	Name    string
+
+	UpSQL   string // SQL statements, used if Up is nil
+	DownSQL string
+
+	Up   func(tx *gorm.DB) error // Go migration
+	Down func(tx *gorm.DB) error
+}
+
+// IsGo whether Go migration
+func (t *Migration) IsGo() bool {
+	return t.Up != nil
+}
+
+// Checksum sha256 of up SQL, or "go" for Go migration
+func (t *Migration) Checksum() string {
+	if t.IsGo() {
+		return checksumGo
+	}
+	sum := sha256.Sum256([]byte(t.UpSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *Migration) up(tx *gorm.DB) error {
+	if t.IsGo() {
+		return t.Up(tx)
+	}
+	return execSQL(tx, t.UpSQL)
+}
+
+func (t *Migration) down(tx *gorm.DB) error {
+	if !t.hasDown() {
+		return errors.Errorf("migration %v has no down", t.Version)
+	}
+	if t.IsGo() {
+		return t.Down(tx)
+	}
+	return execSQL(tx, t.DownSQL)
+}
+
+// hasDown whether migration could be reverted, SQL migration without down file could not
+func (t *Migration) hasDown() bool {
+	if t.IsGo() {
+		return t.Down != nil
+	}
+	return len(splitStatements(t.DownSQL)) > 0
+}
+
+// Record applied migration
+type Record struct {
+	Version   string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"size:255"`
+	Checksum  string `gorm:"size:64"`
+	Dirty     bool   // failed, or still running
+	AppliedAt time.Time
+}
+
+type lockRecord struct {
+	ID       int    `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string `gorm:"size:255"`
+	LockedAt time.Time
+}
+
+// Status status of migration
+type Status struct {
+	Version    string    `json:"version"`
+	Name       string    `json:"name"`
+	Applied    bool      `json:"applied"`
+	AppliedAt  time.Time `json:"appliedAt"`
+	Dirty      bool      `json:"dirty"`      // failed, must be fixed manually and then resolved by Force
+	Changed    bool      `json:"changed"`    // applied but checksum changed
+	Missing    bool      `json:"missing"`    // applied but migration not found
+	OutOfOrder bool      `json:"outOfOrder"` // pending but lower than the highest applied
+}
+
+// Migrator migration runner
+type Migrator struct {
+	db          *gorm.DB
+	migrations  []*Migration
+	isGo        bool
+	table       string
+	lockTimeout time.Duration
+	outOfOrder  bool
+	owner       string
+}
+
+// Option migrator option
+type Option func(*Migrator)
+
+// WithTable table of migration records, default DefaultTable, or DefaultGoTable for Go migrations
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithLockTimeout max duration to wait lock held by others, default wait until ctx done
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = timeout
+	}
+}
+
+// WithOutOfOrder apply pending migrations lower than the highest applied, e.g. merged from other branch,
+// which is refused by default
+func WithOutOfOrder() Option {
+	return func(m *Migrator) {
+		m.outOfOrder = true
+	}
+}
+
+// New create migrator of migrations, which sorted by version, migrations must be all SQL or all Go
+func New(db *gorm.DB, migrations []*Migration, opts ...Option) (*Migrator, error) {
+	hostname, _ := os.Hostname()
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+
+	t := &Migrator{
+		db:    db,
+		owner: fmt.Sprint(hostname, "-", os.Getpid(), "-", hex.EncodeToString(id)),
+	}
+
+	t.migrations = make([]*Migration, 0, len(migrations))
+	versions := make(map[string]bool, len(migrations))
+	for i, m := range migrations {
+		if m.Version == "" {
+			return nil, errors.Errorf("migration %v has no version", m.Name)
+		}
+		if versions[m.Version] {
+			return nil, errors.Errorf("duplicated migration version %v", m.Version)
+		}
+		if i == 0 {
+			t.isGo = m.IsGo()
+		} else if t.isGo != m.IsGo() {
+			return nil, ErrMixed
+		}
+		versions[m.Version] = true
+		t.migrations = append(t.migrations, m)
+	}
+	sort.Slice(t.migrations, func(i, j int) bool {
+		return t.migrations[i].Version < t.migrations[j].Version
+	})
+
+	t.table = DefaultTable
+	if t.isGo {
+		t.table = DefaultGoTable
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, nil
+}
+
+// Up apply all pending migrations, returns number of applied
+func (t *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := t.withLock(ctx, func(db *gorm.DB) error {
+		applied, err := t.applied(db)
+		if err != nil {
+			return err
+		}
+
+		highest := ""
+		for _, r := range applied {
+			if r.Dirty {
+				return errors.Wrapf(ErrDirty, "version %v", r.Version)
+			}
+			if r.Version > highest {
+				highest = r.Version
+			}
+		}
+
+		for _, m := range t.migrations {
+			r, ok := applied[m.Version]
+			if !ok {
+				if m.Version < highest && !t.outOfOrder {
+					return errors.Wrapf(ErrOutOfOrder, "version %v is lower than applied %v", m.Version, highest)
+				}
+				continue
+			}
+			if r.Checksum != m.Checksum() {
+				return errors.Wrapf(ErrChecksumMismatch, "version %v", m.Version)
+			}
+		}
+
+		for _, m := range t.migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			// lock lost
+			if err := db.Statement.Context.Err(); err != nil {
+				return err
+			}
+			if err := t.up(ctx, db, m); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// up apply migration, which is recorded as dirty before run, and cleaned with changes in the same transaction
+func (t *Migrator) up(ctx context.Context, db *gorm.DB, m *Migration) error {
+	start := time.Now()
+	record := &Record{
+		Version:   m.Version,
+		Name:      m.Name,
+		Checksum:  m.Checksum(),
+		Dirty:     true,
+		AppliedAt: start,
+	}
+	if err := db.Table(t.table).Create(record).Error; err != nil {
+		return errors.Wrapf(err, "record %v", m.Version)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := m.up(tx); err != nil {
+			return err
+		}
+		return tx.Table(t.table).Where("version = ?", m.Version).Update("dirty", false).Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "migrate up %v_%v, marked as dirty", m.Version, m.Name)
+	}
+
+	log.For(ctx).Info("migrate up", zap.String("version", m.Version), zap.String("name", m.Name), zap.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// Down revert last applied migrations of steps, returns number of reverted
+func (t *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := t.withLock(ctx, func(db *gorm.DB) error {
+		var dirty int64
+		if err := db.Table(t.table).Where("dirty = ?", true).Count(&dirty).Error; err != nil {
+			return err
+		}
+		if dirty > 0 {
+			return ErrDirty
+		}
+
+		var records []*Record
+		if err := db.Table(t.table).Order("version DESC").Limit(steps).Find(&records).Error; err != nil {
+			return err
+		}
+
+		migrations := make(map[string]*Migration, len(t.migrations))
+		for _, m := range t.migrations {
+			migrations[m.Version] = m
+		}
+
+		// refuse before reverting any, instead of reporting migration without down as reverted
+		for _, r := range records {
+			m, ok := migrations[r.Version]
+			if !ok {
+				return errors.Errorf("migration %v_%v not found", r.Version, r.Name)
+			}
+			if !m.hasDown() {
+				return errors.Errorf("migration %v_%v has no down", m.Version, m.Name)
+			}
+		}
+
+		for _, r := range records {
+			if err := db.Statement.Context.Err(); err != nil {
+				return err
+			}
+			if err := t.down(ctx, db, migrations[r.Version]); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// down revert migration, which is recorded as dirty before run, and removed with changes in the same transaction
+func (t *Migrator) down(ctx context.Context, db *gorm.DB, m *Migration) error {
+	start := time.Now()
+	if err := db.Table(t.table).Where("version = ?", m.Version).Update("dirty", true).Error; err != nil {
+		return errors.Wrapf(err, "record %v", m.Version)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := m.down(tx); err != nil {
+			return err
+		}
+		return tx.Table(t.table).Where("version = ?", m.Version).Delete(&Record{}).Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "migrate down %v_%v, marked as dirty", m.Version, m.Name)
+	}
+
+	log.For(ctx).Info("migrate down", zap.String("version", m.Version), zap.String("name", m.Name), zap.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// Force resolve dirty migration of version after schema fixed manually,
+// which is marked as applied if applied is true, otherwise removed as pending
+func (t *Migrator) Force(ctx context.Context, version string, applied bool) error {
+	return t.withLock(ctx, func(db *gorm.DB) error {
+		query := db.Table(t.table).Where("version = ? AND dirty = ?", version, true)
+
+		var result *gorm.DB
+		if applied {
+			result = query.Update("dirty", false)
+		} else {
+			result = query.Delete(&Record{})
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.Errorf("migration %v is not dirty", version)
+		}
+
+		log.For(ctx).Info("migrate force", zap.String("version", version), zap.Bool("applied", applied))
+		return nil
+	})
+}
+
+// Status returns status of migrations and applied records, sorted by version
+func (t *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	db := t.db.WithContext(ctx)
+	if err := t.ensureTable(db, t.table, &Record{}); err != nil {
+		return nil, err
+	}
+
+	applied, err := t.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	highest := ""
+	for _, r := range applied {
+		if r.Version > highest {
+			highest = r.Version
+		}
+	}
+
+	list := make([]*Status, 0, len(t.migrations))
+	for _, m := range t.migrations {
+		s := &Status{Version: m.Version, Name: m.Name}
+		if r, ok := applied[m.Version]; ok {
+			s.Applied, s.AppliedAt, s.Dirty, s.Changed = true, r.AppliedAt, r.Dirty, r.Checksum != m.Checksum()
+			delete(applied, m.Version)
+		} else {
+			s.OutOfOrder = m.Version < highest
+		}
+		list = append(list, s)
+	}
+	for _, r := range applied {
+		list = append(list, &Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Dirty: r.Dirty, Missing: true})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list, nil
+}
+
+// applied returns records of table, which must be the same kind of migrations
+func (t *Migrator) applied(db *gorm.DB) (map[string]*Record, error) {
+	var records []*Record
+	if err := db.Table(t.table).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[string]*Record, len(records))
+	for _, r := range records {
+		if len(t.migrations) > 0 && (r.Checksum == checksumGo) != t.isGo {
+			return nil, errors.Wrapf(ErrMixed, "table %v, version %v", t.table, r.Version)
+		}
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func (t *Migrator) lockTable() string {
+	return t.table + "_lock"
+}
+
+// withLock run fn while holding migration lock, which is a row of lock table refreshed in background,
+// context of db passed to fn is canceled if lock lost, and ErrLockLost returned
+func (t *Migrator) withLock(ctx context.Context, fn func(db *gorm.DB) error) (err error) {
+	db := t.db.WithContext(ctx)
+	if err := t.ensureTable(db, t.table, &Record{}); err != nil {
+		return err
+	}
+	if err := t.ensureTable(db, t.lockTable(), &lockRecord{}); err != nil {
+		return err
+	}
+
+	var deadline time.Time
+	if t.lockTimeout > 0 {
+		deadline = time.Now().Add(t.lockTimeout)
+	}
+	for {
+		// remove stale lock, which holder is gone
+		db.Table(t.lockTable()).Where("locked_at < ?", time.Now().Add(-lockTTL)).Delete(&lockRecord{})
+
+		err := db.Table(t.lockTable()).Create(&lockRecord{ID: 1, Owner: t.owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			break
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+
+		var holder lockRecord
+		db.Table(t.lockTable()).Limit(1).Find(&holder)
+		log.For(ctx).Info("migrate, waiting lock", zap.String("holder", holder.Owner), zap.Time("lockedAt", holder.LockedAt))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetry):
+		}
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lost int32
+	done := make(chan struct{})
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		t.refreshLock(done, func() {
+			atomic.StoreInt32(&lost, 1)
+			cancel()
+		})
+	}()
+
+	defer func() {
+		close(done)
+		<-refreshed
+		if atomic.LoadInt32(&lost) == 1 {
+			err = ErrLockLost
+		}
+
+		e := t.db.WithContext(context.Background()).Table(t.lockTable()).Where("id = 1 AND owner = ?", t.owner).Delete(&lockRecord{}).Error
+		if e != nil {
+			log.For(ctx).Error("migrate, release lock", zap.Error(e))
+		}
+	}()
+
+	return fn(t.db.WithContext(lockCtx))
+}
+
+// refreshLock refresh lock periodically until done, so long running migration is not considered stale,
+// onLost is called if refresh failed or lock taken by others
+func (t *Migrator) refreshLock(done <-chan struct{}, onLost func()) {
+	ticker := time.NewTicker(lockRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		result := t.db.WithContext(context.Background()).Table(t.lockTable()).
+			Where("id = 1 AND owner = ?", t.owner).Update("locked_at", time.Now())
+		if result.Error != nil {
+			log.Error("migrate, refresh lock, stop migrating", zap.Error(result.Error))
+			onLost()
+			return
+		}
+		if result.RowsAffected == 0 {
+			log.Error("migrate, lock lost, stop migrating", zap.String("owner", t.owner))
+			onLost()
+			return
+		}
+	}
+}
+
+// ensureTable create table if not exists, which may be created by others concurrently
+func (t *Migrator) ensureTable(db *gorm.DB, table string, model interface{}) error {
+	if db.Migrator().HasTable(table) {
+		return nil
+	}
+	if err := db.Table(table).Migrator().CreateTable(model); err != nil && !db.Migrator().HasTable(table) {
+		return err
+	}
+	return nil
+}
+
+// execSQL exec statements separated by semicolon at end of line
+func execSQL(tx *gorm.DB, sql string) error {
+	for _, stmt := range splitStatements(sql) {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitStatements(sql string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+	)
+
+	flush := func() {
+		stmt := strings.TrimSpace(current.String())
+		current.Reset()
+		if stmt != "" && !isComment(stmt) {
+			statements = append(statements, stmt)
+		}
+	}
+
+	for _, line := range strings.Split(sql, "\n") {
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			flush()
+		}
+	}
+	flush()
+
+	return statements
+}
+
+// isComment whether all lines are comment
+func isComment(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,348 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openDb(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "migrate.db")+"?_pragma=busy_timeout(5000)"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- comment
+CREATE TABLE a (id INTEGER);
+INSERT INTO a VALUES (1),
+  (2);
+
+-- trailing comment
+`
+	assert.Equal(t, []string{
+		"-- comment\nCREATE TABLE a (id INTEGER);",
+		"INSERT INTO a VALUES (1),\n  (2);",
+	}, splitStatements(sql))
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2_add_b.up.sql":     {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"1_add_a.up.sql":     {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"1_add_a.down.sql":   {Data: []byte("DROP TABLE a;")},
+		"README.md":          {Data: []byte("ignored")},
+		"sub/3_add_c.up.sql": {Data: []byte("ignored")},
+	}
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, "1", migrations[0].Version)
+	assert.Equal(t, "add_a", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE a;", migrations[0].DownSQL)
+
+	_, err = Load(fstest.MapFS{"1_add_a.down.sql": {Data: []byte("DROP TABLE a;")}})
+	assert.Error(t, err)
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	files, err := Create(dir, "add_user")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	migrations, err := LoadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	assert.Equal(t, "add_user", migrations[0].Name)
+
+	_, err = Create(dir, "add user")
+	assert.Error(t, err)
+}
+
+func TestMigrator(t *testing.T) {
+	db := openDb(t)
+	ctx := context.Background()
+
+	migrations := []*Migration{
+		{Version: "2", Name: "seed", UpSQL: "INSERT INTO a VALUES (1);", DownSQL: "DELETE FROM a;"},
+		{Version: "1", Name: "add_a", UpSQL: "CREATE TABLE a (id INTEGER);\nCREATE TABLE b (id INTEGER);", DownSQL: "DROP TABLE b;\nDROP TABLE a;"},
+	}
+	m, err := New(db, migrations)
+	require.NoError(t, err)
+
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.True(t, db.Migrator().HasTable("b"))
+
+	// idempotent
+	n, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "1", list[0].Version)
+	assert.True(t, list[0].Applied)
+	assert.True(t, list[1].Applied)
+
+	// checksum changed
+	changed, err := New(db, []*Migration{{Version: "1", Name: "add_a", UpSQL: "CREATE TABLE a (id TEXT);"}, migrations[0]})
+	require.NoError(t, err)
+	_, err = changed.Up(ctx)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+	list, err = changed.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, list[0].Changed)
+
+	// down step by step
+	n, err = m.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	var count int64
+	require.NoError(t, db.Table("a").Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+
+	n, err = m.Down(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, db.Migrator().HasTable("a"))
+
+	_, err = New(db, []*Migration{{Version: "1"}, {Version: "1"}})
+	assert.Error(t, err)
+}
+
+func TestMigratorDirty(t *testing.T) {
+	db := openDb(t)
+	ctx := context.Background()
+
+	// second statement failed, first one may be committed by non-transactional DDL, e.g. mysql
+	migrations := []*Migration{
+		{Version: "1", Name: "add_a", UpSQL: "CREATE TABLE a (id INTEGER);\nINSERT INTO missing VALUES (1);", DownSQL: "DROP TABLE a;"},
+		{Version: "2", Name: "add_b", UpSQL: "CREATE TABLE b (id INTEGER);", DownSQL: "DROP TABLE b;"},
+	}
+	m, err := New(db, migrations)
+	require.NoError(t, err)
+
+	n, err := m.Up(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, list[0].Applied)
+	assert.True(t, list[0].Dirty)
+	assert.False(t, list[1].Applied)
+
+	_, err = m.Up(ctx)
+	assert.True(t, errors.Is(err, ErrDirty))
+	_, err = m.Down(ctx, 1)
+	assert.True(t, errors.Is(err, ErrDirty))
+
+	// fixed manually and retry
+	migrations[0].UpSQL = "CREATE TABLE a (id INTEGER);"
+	assert.Error(t, m.Force(ctx, "2", false), "not dirty")
+	require.NoError(t, m.Force(ctx, "1", false))
+	n, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	list, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, list[0].Dirty)
+	assert.True(t, list[1].Applied)
+
+	// failed down
+	migrations[1].DownSQL = "DROP TABLE missing;"
+	_, err = m.Down(ctx, 1)
+	assert.Error(t, err)
+	list, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, list[1].Dirty)
+	require.NoError(t, m.Force(ctx, "2", true))
+	list, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, list[1].Dirty)
+	assert.True(t, list[1].Applied)
+}
+
+func TestMigratorOutOfOrder(t *testing.T) {
+	db := openDb(t)
+	ctx := context.Background()
+
+	m, err := New(db, []*Migration{{Version: "1", UpSQL: "CREATE TABLE a (id INTEGER);"}, {Version: "3", UpSQL: "CREATE TABLE c (id INTEGER);"}})
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	// merged from other branch
+	migrations := []*Migration{
+		{Version: "1", UpSQL: "CREATE TABLE a (id INTEGER);"},
+		{Version: "2", UpSQL: "CREATE TABLE b (id INTEGER);"},
+		{Version: "3", UpSQL: "CREATE TABLE c (id INTEGER);"},
+	}
+	m, err = New(db, migrations)
+	require.NoError(t, err)
+
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, list[1].OutOfOrder)
+
+	_, err = m.Up(ctx)
+	assert.True(t, errors.Is(err, ErrOutOfOrder))
+	assert.False(t, db.Migrator().HasTable("b"))
+
+	m, err = New(db, migrations, WithOutOfOrder())
+	require.NoError(t, err)
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestMigratorMixed(t *testing.T) {
+	db := openDb(t)
+	ctx := context.Background()
+
+	goMigration := &Migration{Version: "2", Up: func(tx *gorm.DB) error { return nil }}
+	_, err := New(db, []*Migration{{Version: "1", UpSQL: "SELECT 1;"}, goMigration})
+	assert.Equal(t, ErrMixed, err)
+
+	// Go migrations are recorded in separated table
+	m, err := New(db, []*Migration{goMigration})
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.True(t, db.Migrator().HasTable(DefaultGoTable))
+
+	sql, err := New(db, []*Migration{{Version: "1", UpSQL: "SELECT 1;"}})
+	require.NoError(t, err)
+	list, err := sql.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.False(t, list[0].Applied)
+
+	// enforced on records
+	m, err = New(db, []*Migration{goMigration}, WithTable(DefaultTable))
+	require.NoError(t, err)
+	_, err = sql.Up(ctx)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	assert.True(t, errors.Is(err, ErrMixed))
+}
+
+func TestMigratorLock(t *testing.T) {
+	db := openDb(t)
+	ctx := context.Background()
+
+	m, err := New(db, nil, WithLockTimeout(time.Millisecond))
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	// held by others
+	require.NoError(t, db.Table(m.lockTable()).Create(&lockRecord{ID: 1, Owner: "other", LockedAt: time.Now()}).Error)
+	_, err = m.Up(ctx)
+	assert.Equal(t, ErrLockTimeout, err)
+
+	// stale lock is removed
+	require.NoError(t, db.Table(m.lockTable()).Where("id = 1").Update("locked_at", time.Now().Add(-lockTTL*2)).Error)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, db.Table(m.lockTable()).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestMigratorLockRefresh(t *testing.T) {
+	refresh, ttl := lockRefresh, lockTTL
+	lockRefresh, lockTTL = time.Millisecond*10, time.Millisecond*50
+	defer func() { lockRefresh, lockTTL = refresh, ttl }()
+
+	db := openDb(t)
+	ctx := context.Background()
+
+	m, err := New(db, nil)
+	require.NoError(t, err)
+	other, err := New(db, nil, WithLockTimeout(time.Millisecond))
+	require.NoError(t, err)
+
+	err = m.withLock(ctx, func(db *gorm.DB) error {
+		// long running migration is not considered stale
+		time.Sleep(lockTTL * 3)
+		_, err := other.Up(ctx)
+		assert.Equal(t, ErrLockTimeout, err)
+
+		var lock lockRecord
+		require.NoError(t, db.Table(m.lockTable()).First(&lock).Error)
+		assert.Equal(t, m.owner, lock.Owner)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMigratorLockLost(t *testing.T) {
+	refresh := lockRefresh
+	lockRefresh = time.Millisecond * 10
+	defer func() { lockRefresh = refresh }()
+
+	db := openDb(t)
+	m, err := New(db, nil)
+	require.NoError(t, err)
+
+	err = m.withLock(context.Background(), func(db *gorm.DB) error {
+		// taken by others as stale
+		require.NoError(t, db.Table(m.lockTable()).Where("id = 1").Update("owner", "other").Error)
+
+		select {
+		case <-db.Statement.Context.Done():
+			return db.Statement.Context.Err()
+		case <-time.After(time.Second):
+			t.Error("context of fn not canceled after lock lost")
+			return nil
+		}
+	})
+	assert.Equal(t, ErrLockLost, err)
+}
+
+func TestMigratorDownWithoutDown(t *testing.T) {
+	db := openDb(t)
+	ctx := context.Background()
+
+	m, err := New(db, []*Migration{
+		{Version: "1", Name: "add_a", UpSQL: "CREATE TABLE a (id INTEGER);", DownSQL: "DROP TABLE a;"},
+		{Version: "2", Name: "add_b", UpSQL: "CREATE TABLE b (id INTEGER);"},
+	})
+	require.NoError(t, err)
+
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// refused before reverting any
+	n, err = m.Down(ctx, 2)
+	assert.EqualError(t, err, "migration 2_add_b has no down")
+	assert.Equal(t, 0, n)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range status {
+		assert.True(t, s.Applied, s.Version)
+		assert.False(t, s.Dirty, s.Version)
+	}
+	assert.True(t, db.Migrator().HasTable("a"))
+	assert.True(t, db.Migrator().HasTable("b"))
+}
@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+	registered   = make(map[string][]*Migration)
+	registeredMu sync.RWMutex
+)
+
+// Register register Go migrations of database name, e.g. in init, which are applied on startup after SQL migrations,
+// and recorded in DefaultGoTable
+func Register(database string, migrations ...*Migration) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered[database] = append(registered[database], migrations...)
+}
+
+// Registered returns Go migrations of database name
+func Registered(database string) []*Migration {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	return append([]*Migration(nil), registered[database]...)
+}
+
+// Load load SQL migrations from files of fsys root, e.g. embed.FS
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[string]*Migration, len(entries))
+	list := make([]*Migration, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		matches := fileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		version, name, direction := matches[1], matches[2], matches[3]
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			migrations[version] = m
+			list = append(list, m)
+		} else if m.Name != name {
+			return nil, errors.Errorf("duplicated migration version %v: %v, %v", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.UpSQL = string(data)
+		} else {
+			m.DownSQL = string(data)
+		}
+	}
+
+	for _, m := range list {
+		if m.UpSQL == "" {
+			return nil, errors.Errorf("migration %v_%v has no up file", m.Version, m.Name)
+		}
+	}
+
+	return list, nil
+}
+
+// LoadDir load SQL migrations from files of dir
+func LoadDir(dir string) ([]*Migration, error) {
+	return Load(os.DirFS(dir))
+}
+
+// Create create empty up & down SQL files of name in dir, versioned by current time
+func Create(dir, name string) ([]string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return nil, errors.Errorf("invalid migration name %v, only letters, digits and underscore", name)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	version := time.Now().Format("20060102150405")
+	files := make([]string, 0, 2)
+	for _, direction := range []string{"up", "down"} {
+		file := filepath.Join(dir, fmt.Sprintf("%v_%v.%v.sql", version, name, direction))
+		content := fmt.Sprintf("-- %v %v\n", name, direction)
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
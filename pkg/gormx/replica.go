@@ -0,0 +1,210 @@
+package gormx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	PolicyRandom     = "random"     // pick healthy replica randomly, default
+	PolicyRoundRobin = "roundrobin" // pick healthy replica in turn
+
+	replicaCheckInterval = time.Second * 5
+	replicaCheckTimeout  = time.Second * 2
+
+	settingPrimary = "gormx:primary"
+)
+
+type primaryContextKey struct{}
+
+// WithPrimary force queries with returned context to primary, e.g. read after write in the same request
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// UsePrimary force queries of returned db to primary
+func UsePrimary(db *gorm.DB) *gorm.DB {
+	return db.Set(settingPrimary, true)
+}
+
+type replica struct {
+	index   int
+	pool    *sql.DB
+	healthy int32
+}
+
+// replicaResolver gorm plugin routes read queries to healthy replicas, others to primary.
+// queries in transaction, locking (FOR UPDATE) or forced to primary are not routed
+type replicaResolver struct {
+	name     string
+	policy   string
+	replicas []*replica
+	next     uint32
+	stop     chan struct{}
+}
+
+// useReplicas open replica pools with same pool settings of primary, and register resolver to db
+func useReplicas(db *gorm.DB, cfg DbConfig, opener Opener) error {
+	switch cfg.Policy {
+	case "", PolicyRandom, PolicyRoundRobin:
+	default:
+		return fmt.Errorf("unsupported replica policy: %v", cfg.Policy)
+	}
+
+	t := &replicaResolver{
+		name:     cfg.Name,
+		policy:   cfg.Policy,
+		replicas: make([]*replica, 0, len(cfg.Replicas)),
+		stop:     make(chan struct{}),
+	}
+
+	// replica down at startup is evicted by check instead of failing startup
+	for i, uri := range cfg.Replicas {
+		rdb, err := gorm.Open(opener(uri), &gorm.Config{Logger: db.Logger, DisableAutomaticPing: true})
+		if err != nil {
+			return fmt.Errorf("open replica %d: %w", i, err)
+		}
+		pool, err := rdb.DB()
+		if err != nil {
+			return fmt.Errorf("open replica %d: %w", i, err)
+		}
+		configPool(pool, cfg)
+		t.replicas = append(t.replicas, &replica{index: i, pool: pool, healthy: 1})
+	}
+
+	if err := db.Use(t); err != nil {
+		return err
+	}
+
+	t.check()
+	go t.run()
+
+	lifecycle.OnStop(fmt.Sprint("database-replicas:", cfg.Name), func(context.Context) error {
+		close(t.stop)
+		for _, r := range t.replicas {
+			_ = r.pool.Close()
+		}
+		return nil
+	}, lifecycle.WithPriority(lifecycle.PriorityResource))
+
+	return nil
+}
+
+// Name implements gorm.Plugin
+func (t *replicaResolver) Name() string {
+	return "gormx:replicas"
+}
+
+// Initialize implements gorm.Plugin
+func (t *replicaResolver) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("*").Register("gormx:replicas", t.switchReplica); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("*").Register("gormx:replicas", t.switchReplica)
+}
+
+func (t *replicaResolver) switchReplica(db *gorm.DB) {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok || forcePrimary(db) {
+		return
+	}
+
+	if rawSQL := strings.TrimSpace(db.Statement.SQL.String()); rawSQL != "" {
+		if !isReadSQL(rawSQL) {
+			return
+		}
+	} else if _, locking := db.Statement.Clauses["FOR"]; locking {
+		return
+	}
+
+	if pool := t.resolve(); pool != nil {
+		db.Statement.ConnPool = pool
+	}
+}
+
+// resolve pick healthy replica by policy, nil if no healthy replica
+func (t *replicaResolver) resolve() *sql.DB {
+	healthy := make([]*sql.DB, 0, len(t.replicas))
+	for _, r := range t.replicas {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			healthy = append(healthy, r.pool)
+		}
+	}
+
+	switch len(healthy) {
+	case 0:
+		return nil
+	case 1:
+		return healthy[0]
+	}
+
+	if t.policy == PolicyRoundRobin {
+		return healthy[int(atomic.AddUint32(&t.next, 1)-1)%len(healthy)]
+	}
+	return healthy[rand.Intn(len(healthy))]
+}
+
+func (t *replicaResolver) run() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.check()
+		}
+	}
+}
+
+// check ping replicas, failing replicas are evicted until ping succeeded
+func (t *replicaResolver) check() {
+	for _, r := range t.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+		err := r.pool.PingContext(ctx)
+		cancel()
+
+		if err != nil {
+			if atomic.CompareAndSwapInt32(&r.healthy, 1, 0) {
+				log.Warn("database replica evicted", zap.String("name", t.name), zap.Int("replica", r.index), zap.Error(err))
+			}
+			continue
+		}
+
+		if atomic.CompareAndSwapInt32(&r.healthy, 0, 1) {
+			log.Info("database replica recovered", zap.String("name", t.name), zap.Int("replica", r.index))
+		}
+	}
+}
+
+func forcePrimary(db *gorm.DB) bool {
+	if v, ok := db.Get(settingPrimary); ok && v == true {
+		return true
+	}
+	if ctx := db.Statement.Context; ctx != nil {
+		if v, ok := ctx.Value(primaryContextKey{}).(bool); ok && v {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadSQL guess whether raw sql is read only, select but not locking
+func isReadSQL(rawSQL string) bool {
+	if len(rawSQL) < 6 || !strings.EqualFold(rawSQL[:6], "select") {
+		return false
+	}
+	lower := strings.ToLower(rawSQL)
+	return !strings.HasSuffix(lower, "for update") && !strings.HasSuffix(lower, "lock in share mode") && !strings.HasSuffix(lower, "for share")
+}
@@ -0,0 +1,116 @@
+package gormx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// fakeDriver opens connections unless down
+type fakeDriver struct {
+	down int32
+}
+
+func (t *fakeDriver) Open(string) (driver.Conn, error) {
+	if atomic.LoadInt32(&t.down) == 1 {
+		return nil, errors.New("down")
+	}
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+var fakeDrivers = map[string]*fakeDriver{"replica0": {}, "replica1": {}}
+
+func init() {
+	for name, d := range fakeDrivers {
+		sql.Register(name, d)
+	}
+}
+
+func newTestResolver(policy string) *replicaResolver {
+	t := &replicaResolver{name: "test", policy: policy}
+	for i, name := range []string{"replica0", "replica1"} {
+		pool, _ := sql.Open(name, "")
+		pool.SetMaxIdleConns(0)
+		t.replicas = append(t.replicas, &replica{index: i, pool: pool, healthy: 1})
+	}
+	return t
+}
+
+func TestReplicaResolve(t *testing.T) {
+	r := newTestResolver(PolicyRoundRobin)
+	assert.Equal(t, r.replicas[0].pool, r.resolve())
+	assert.Equal(t, r.replicas[1].pool, r.resolve())
+	assert.Equal(t, r.replicas[0].pool, r.resolve())
+
+	r = newTestResolver(PolicyRandom)
+	seen := map[*sql.DB]bool{}
+	for i := 0; i < 100; i++ {
+		seen[r.resolve()] = true
+	}
+	assert.Len(t, seen, 2)
+}
+
+func TestReplicaEviction(t *testing.T) {
+	r := newTestResolver(PolicyRoundRobin)
+
+	atomic.StoreInt32(&fakeDrivers["replica0"].down, 1)
+	r.check()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, r.replicas[1].pool, r.resolve())
+	}
+
+	atomic.StoreInt32(&fakeDrivers["replica1"].down, 1)
+	r.check()
+	assert.Nil(t, r.resolve(), "fallback to primary")
+
+	atomic.StoreInt32(&fakeDrivers["replica0"].down, 0)
+	atomic.StoreInt32(&fakeDrivers["replica1"].down, 0)
+	r.check()
+	assert.NotNil(t, r.resolve())
+}
+
+func TestReplicaUnreachable(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	cfg := DbConfig{Name: "unreachable", Replicas: []string{"user:password@tcp(127.0.0.1:1)/db?timeout=100ms"}}
+	require.NoError(t, useReplicas(db, cfg, replicaOpener(DriverMySQL, mysql.Open)), "replica down should not fail startup")
+
+	var one int
+	assert.NoError(t, db.Raw("select 1").Scan(&one).Error, "fallback to primary")
+	assert.Equal(t, 1, one)
+}
+
+func TestForcePrimary(t *testing.T) {
+	db := &gorm.DB{Config: &gorm.Config{}, Statement: &gorm.Statement{Context: context.Background(), Settings: sync.Map{}}}
+	db.Statement.DB = db
+	assert.False(t, forcePrimary(db))
+	assert.True(t, forcePrimary(UsePrimary(db)))
+
+	db.Statement.Context = WithPrimary(context.Background())
+	assert.True(t, forcePrimary(db))
+}
+
+func TestIsReadSQL(t *testing.T) {
+	assert.True(t, isReadSQL("SELECT * FROM user"))
+	assert.True(t, isReadSQL("select 1"))
+	assert.False(t, isReadSQL("UPDATE user SET name = ''"))
+	assert.False(t, isReadSQL("SELECT * FROM user WHERE id = 1 FOR UPDATE"))
+	assert.False(t, isReadSQL("select * from user lock in share mode"))
+}
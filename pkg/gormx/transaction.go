@@ -0,0 +1,165 @@
+package gormx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+type txContextKey struct {
+	name string
+}
+
+// txState transaction of context, nested transaction shares tx of root with savepoint
+type txState struct {
+	tx     *gorm.DB
+	root   *txState
+	parent *txState
+
+	mu          sync.Mutex
+	afterCommit []func(ctx context.Context)
+	savepoints  int // of root
+}
+
+func (t *txState) nextSavePoint() string {
+	t.root.mu.Lock()
+	defer t.root.mu.Unlock()
+	t.root.savepoints++
+	return fmt.Sprint("gormx_sp", t.root.savepoints)
+}
+
+func (t *txState) addAfterCommit(fn ...func(ctx context.Context)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.afterCommit = append(t.afterCommit, fn...)
+}
+
+func (t *txState) callbacks() []func(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.afterCommit
+}
+
+// Transaction run fn in transaction of db name, committed if nil returned, otherwise rollback.
+// tx is stored in context of fn, inner calls get it by FromContext, and nested Transaction of the same name
+// uses savepoint, which rollback to savepoint only
+func Transaction(ctx context.Context, name string, fn func(ctx context.Context, tx *gorm.DB) error, opts ...*sql.TxOptions) (err error) {
+	parent, _ := ctx.Value(txContextKey{name}).(*txState)
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db.transaction")
+	ext.DBInstance.Set(span, name)
+	span.SetTag("db.nested", parent != nil)
+
+	start := time.Now()
+	panicked := true
+	defer func() {
+		status := statusCommit
+		if panicked || err != nil {
+			status = statusRollback
+			ext.Error.Set(span, true)
+			if err != nil {
+				span.SetTag("error.message", err.Error())
+			}
+		}
+		span.SetTag("db.status", status)
+		span.Finish()
+
+		if parent == nil {
+			observeTransaction(name, status, time.Since(start))
+		}
+	}()
+
+	if parent != nil {
+		err = nestedTransaction(ctx, name, parent, fn)
+		panicked = false
+		return
+	}
+
+	db := Get(name)
+	if db == nil {
+		panicked = false
+		return errors.Errorf("database %v not configured", name)
+	}
+
+	state := &txState{}
+	state.root = state
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state.tx = tx
+		return fn(context.WithValue(ctx, txContextKey{name}, state), tx)
+	}, opts...)
+	panicked = false
+
+	if err == nil {
+		runAfterCommit(ctx, state.callbacks())
+	}
+	return
+}
+
+func nestedTransaction(ctx context.Context, name string, parent *txState, fn func(ctx context.Context, tx *gorm.DB) error) (err error) {
+	sp := parent.nextSavePoint()
+	if err = parent.tx.SavePoint(sp).Error; err != nil {
+		return
+	}
+
+	state := &txState{tx: parent.tx, root: parent.root, parent: parent}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			// after commit callbacks of savepoint are discarded
+			if rbErr := parent.tx.RollbackTo(sp).Error; rbErr != nil {
+				log.For(ctx).Error("rollback to savepoint", zap.String("name", name), zap.Error(rbErr))
+			}
+			return
+		}
+		parent.addAfterCommit(state.callbacks()...)
+	}()
+
+	err = fn(context.WithValue(ctx, txContextKey{name}, state), parent.tx)
+	panicked = false
+	return
+}
+
+// FromContext get tx of db name in context if in Transaction, otherwise db of name, with context
+func FromContext(ctx context.Context, name string) *gorm.DB {
+	if state, ok := ctx.Value(txContextKey{name}).(*txState); ok {
+		return state.tx.WithContext(ctx)
+	}
+	if db := Get(name); db != nil {
+		return db.WithContext(ctx)
+	}
+	return nil
+}
+
+// AfterCommit register fn called after transaction of db name in context committed, e.g. send events,
+// fn is discarded if rollback, or called immediately if not in transaction
+func AfterCommit(ctx context.Context, name string, fn func(ctx context.Context)) {
+	if state, ok := ctx.Value(txContextKey{name}).(*txState); ok {
+		state.addAfterCommit(fn)
+		return
+	}
+	runAfterCommit(ctx, []func(ctx context.Context){fn})
+}
+
+func runAfterCommit(ctx context.Context, fns []func(ctx context.Context)) {
+	for _, fn := range fns {
+		func() {
+			defer func() {
+				if x := recover(); x != nil {
+					log.For(ctx).Error("after commit panic", zap.Any("err", x))
+				}
+			}()
+			fn(ctx)
+		}()
+	}
+}
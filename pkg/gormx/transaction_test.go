@@ -0,0 +1,98 @@
+package gormx
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTransaction(t *testing.T) {
+	v := viper.New()
+	v.Set("database", []map[string]interface{}{
+		{"name": "tx", "driver": "sqlite", "uri": filepath.Join(t.TempDir(), "tx.db")},
+	})
+	Config(v)
+	require.NoError(t, Get("tx").AutoMigrate(&user{}))
+
+	ctx := context.Background()
+	count := func(name string) int64 {
+		var n int64
+		require.NoError(t, FromContext(ctx, "tx").Model(&user{}).Where("name = ?", name).Count(&n).Error)
+		return n
+	}
+
+	var events []string
+	event := func(name string) func(context.Context) {
+		return func(context.Context) { events = append(events, name) }
+	}
+
+	// commit, inner call reuses tx from context
+	err := Transaction(ctx, "tx", func(ctx context.Context, tx *gorm.DB) error {
+		AfterCommit(ctx, "tx", event("commit"))
+		return FromContext(ctx, "tx").Create(&user{Name: "commit"}).Error
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count("commit"))
+	assert.Equal(t, []string{"commit"}, events)
+
+	// rollback
+	events = nil
+	errFn := errors.New("rollback")
+	err = Transaction(ctx, "tx", func(ctx context.Context, tx *gorm.DB) error {
+		AfterCommit(ctx, "tx", event("rollback"))
+		require.NoError(t, tx.Create(&user{Name: "rollback"}).Error)
+		return errFn
+	})
+	assert.Equal(t, errFn, err)
+	assert.Equal(t, int64(0), count("rollback"))
+	assert.Empty(t, events)
+
+	// nested savepoint rollback
+	err = Transaction(ctx, "tx", func(ctx context.Context, tx *gorm.DB) error {
+		AfterCommit(ctx, "tx", event("outer"))
+		require.NoError(t, tx.Create(&user{Name: "outer"}).Error)
+
+		err := Transaction(ctx, "tx", func(ctx context.Context, tx *gorm.DB) error {
+			AfterCommit(ctx, "tx", event("inner-rollback"))
+			require.NoError(t, FromContext(ctx, "tx").Create(&user{Name: "inner-rollback"}).Error)
+			return errFn
+		})
+		assert.Equal(t, errFn, err)
+
+		return Transaction(ctx, "tx", func(ctx context.Context, tx *gorm.DB) error {
+			AfterCommit(ctx, "tx", event("inner"))
+			return tx.Create(&user{Name: "inner"}).Error
+		})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count("outer"))
+	assert.Equal(t, int64(0), count("inner-rollback"))
+	assert.Equal(t, int64(1), count("inner"))
+	assert.Equal(t, []string{"outer", "inner"}, events)
+
+	// panic
+	assert.Panics(t, func() {
+		_ = Transaction(ctx, "tx", func(ctx context.Context, tx *gorm.DB) error {
+			require.NoError(t, tx.Create(&user{Name: "panic"}).Error)
+			panic("panic")
+		})
+	})
+	assert.Equal(t, int64(0), count("panic"))
+
+	// not in transaction, called immediately
+	events = nil
+	AfterCommit(ctx, "tx", event("immediately"))
+	assert.Equal(t, []string{"immediately"}, events)
+
+	assert.Error(t, Transaction(ctx, "missing", func(ctx context.Context, tx *gorm.DB) error { return nil }))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(transactions.WithLabelValues("tx", statusCommit)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(transactions.WithLabelValues("tx", statusRollback)))
+}
@@ -0,0 +1,32 @@
+package health
+
+import "github.com/labstack/echo/v4"
+
+var (
+	defaultHealth = New()
+)
+
+// Default returns the global health instance, which builtin packages register checkers to
+func Default() *Health {
+	return defaultHealth
+}
+
+// Register add dependency checker to global health instance
+func Register(name string, fn CheckFunc, opts ...Option) {
+	defaultHealth.Register(name, fn, opts...)
+}
+
+// Unregister remove dependency checker from global health instance
+func Unregister(name string) {
+	defaultHealth.Unregister(name)
+}
+
+// LivenessHandler echo handler for global liveness
+func LivenessHandler() echo.HandlerFunc {
+	return defaultHealth.LivenessHandler()
+}
+
+// ReadinessHandler echo handler for global readiness
+func ReadinessHandler() echo.HandlerFunc {
+	return defaultHealth.ReadinessHandler()
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// WatchGrpc check periodically and update serving status of grpc services until ctx done,
+// empty service name means overall status
+func (t *Health) WatchGrpc(ctx context.Context, server *grpchealth.Server, services []string, interval time.Duration) {
+	update := func() {
+		var results []CheckResult
+		if !t.Draining() {
+			results = t.run(ctx, func(*checker) bool { return true })
+		}
+
+		for _, service := range services {
+			status := healthpb.HealthCheckResponse_SERVING
+			if t.Draining() || aggregate(results, service).Status != StatusUp {
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+			server.SetServingStatus(service, status)
+		}
+	}
+
+	update()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			update()
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LivenessHandler echo handler for liveness, e.g. /healthz
+func (t *Health) LivenessHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return render(c, t.Liveness(c.Request().Context()))
+	}
+}
+
+// ReadinessHandler echo handler for readiness, e.g. /readyz
+func (t *Health) ReadinessHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return render(c, t.Readiness(c.Request().Context()))
+	}
+}
+
+func render(c echo.Context, result *Result) error {
+	code := http.StatusOK
+	if result.Status != StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	return c.JSON(code, result)
+}
@@ -0,0 +1,235 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status is health status
+type Status string
+
+const (
+	StatusUp   Status = "up"   // healthy
+	StatusDown Status = "down" // unhealthy
+)
+
+const (
+	DefaultCheckTimeout = time.Second * 3 // default timeout for each checker
+)
+
+// CheckFunc check dependency, returns error if unhealthy
+type CheckFunc func(ctx context.Context) error
+
+type checker struct {
+	name     string
+	fn       CheckFunc
+	liveness bool
+	services []string
+	timeout  time.Duration
+}
+
+// applyTo check whether checker applied to grpc service, empty services means all
+func (t *checker) applyTo(service string) bool {
+	if len(t.services) == 0 || service == "" {
+		return true
+	}
+	for _, s := range t.services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Option for checker option
+type Option func(*checker)
+
+// Liveness mark checker as liveness checker, which also affects liveness,
+// default checker only affects readiness
+func Liveness() Option {
+	return func(c *checker) {
+		c.liveness = true
+	}
+}
+
+// WithServices limit checker to grpc services (full service name, e.g. buf.v1.GreeterService),
+// default checker applies to all services
+func WithServices(services ...string) Option {
+	return func(c *checker) {
+		c.services = services
+	}
+}
+
+// WithTimeout set checker timeout, default DefaultCheckTimeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *checker) {
+		c.timeout = timeout
+	}
+}
+
+// CheckResult is the result of single checker
+type CheckResult struct {
+	Name    string        `json:"name"`
+	Status  Status        `json:"status"`
+	Error   string        `json:"error,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
+
+	checker *checker
+}
+
+// Result is the aggregated result of checkers
+type Result struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Health manage dependency checkers
+type Health struct {
+	mu       sync.RWMutex
+	checkers map[string]*checker
+	draining int32
+}
+
+// New create health instance
+func New() *Health {
+	return &Health{
+		checkers: make(map[string]*checker, 8),
+	}
+}
+
+// Register add dependency checker, register again with same name will replace it
+func (t *Health) Register(name string, fn CheckFunc, opts ...Option) {
+	c := &checker{
+		name:    name,
+		fn:      fn,
+		timeout: DefaultCheckTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checkers[name] = c
+}
+
+// Unregister remove dependency checker
+func (t *Health) Unregister(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.checkers, name)
+}
+
+// SetDraining set draining state, readiness will be down when draining, e.g. during shutdown
+func (t *Health) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&t.draining, v)
+}
+
+// Draining returns whether draining
+func (t *Health) Draining() bool {
+	return atomic.LoadInt32(&t.draining) == 1
+}
+
+// Liveness run liveness checkers
+func (t *Health) Liveness(ctx context.Context) *Result {
+	return aggregate(t.run(ctx, func(c *checker) bool { return c.liveness }), "")
+}
+
+// Readiness run all checkers, down if draining
+func (t *Health) Readiness(ctx context.Context) *Result {
+	return t.ServiceReadiness(ctx, "")
+}
+
+// ServiceReadiness run checkers applied to grpc service, empty service means all checkers
+func (t *Health) ServiceReadiness(ctx context.Context, service string) *Result {
+	if t.Draining() {
+		return &Result{Status: StatusDown}
+	}
+	return aggregate(t.run(ctx, func(c *checker) bool { return c.applyTo(service) }), service)
+}
+
+// run run checkers concurrently
+func (t *Health) run(ctx context.Context, filter func(*checker) bool) []CheckResult {
+	t.mu.RLock()
+	checkers := make([]*checker, 0, len(t.checkers))
+	for _, c := range t.checkers {
+		if filter(c) {
+			checkers = append(checkers, c)
+		}
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(checkers, func(i, j int) bool {
+		return checkers[i].name < checkers[j].name
+	})
+
+	results := make([]CheckResult, len(checkers))
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func(i int, c *checker) {
+			defer wg.Done()
+			results[i] = check(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// aggregate checker results applied to service
+func aggregate(results []CheckResult, service string) *Result {
+	result := &Result{Status: StatusUp, Checks: make([]CheckResult, 0, len(results))}
+	for _, r := range results {
+		if !r.checker.applyTo(service) {
+			continue
+		}
+		if r.Status != StatusUp {
+			result.Status = StatusDown
+		}
+		result.Checks = append(result.Checks, r)
+	}
+	return result
+}
+
+func check(ctx context.Context, c *checker) (result CheckResult) {
+	result = CheckResult{Name: c.name, Status: StatusUp, checker: c}
+	start := time.Now()
+	defer func() {
+		result.Elapsed = time.Since(start)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if x := recover(); x != nil {
+				ch <- fmt.Errorf("panic: %v", x)
+			}
+		}()
+		ch <- c.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-ch:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func Test_readiness(t *testing.T) {
+	h := New()
+	h.Register("ok", func(context.Context) error { return nil }, Liveness())
+	h.Register("failed", func(context.Context) error { return errors.New("failed") }, WithServices("svc.A"))
+	h.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithServices("svc.A"), WithTimeout(time.Millisecond*10))
+
+	ctx := context.Background()
+	assert.Equal(t, StatusUp, h.Liveness(ctx).Status)
+	assert.Len(t, h.Liveness(ctx).Checks, 1)
+
+	r := h.Readiness(ctx)
+	assert.Equal(t, StatusDown, r.Status)
+	assert.Len(t, r.Checks, 3)
+
+	assert.Equal(t, StatusDown, h.ServiceReadiness(ctx, "svc.A").Status)
+	assert.Equal(t, StatusUp, h.ServiceReadiness(ctx, "svc.B").Status)
+
+	h.SetDraining(true)
+	assert.Equal(t, StatusDown, h.ServiceReadiness(ctx, "svc.B").Status)
+	assert.Equal(t, StatusUp, h.Liveness(ctx).Status)
+}
+
+func Test_handler(t *testing.T) {
+	h := New()
+	e := echo.New()
+	e.GET("/healthz", h.LivenessHandler())
+	e.GET("/readyz", h.ReadinessHandler())
+
+	do := func(path string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("/readyz"))
+	h.Register("failed", func(context.Context) error { return errors.New("failed") })
+	assert.Equal(t, http.StatusServiceUnavailable, do("/readyz"))
+	assert.Equal(t, http.StatusOK, do("/healthz"))
+}
+
+func Test_watchGrpc(t *testing.T) {
+	h := New()
+	h.Register("failed", func(context.Context) error { return errors.New("failed") }, WithServices("svc.A"))
+
+	server := grpchealth.NewServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.WatchGrpc(ctx, server, []string{"", "svc.A", "svc.B"}, time.Second)
+
+	status := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		rsp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(t, err)
+		return rsp.Status
+	}
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status("svc.A"))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status("svc.B"))
+}
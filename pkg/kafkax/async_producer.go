@@ -0,0 +1,222 @@
+package kafkax
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	BackpressureBlock = "block" // block until buffer available or context done, default
+	BackpressureDrop  = "drop"  // drop message, callback with ErrBufferFull
+	BackpressureError = "error" // return ErrBufferFull
+
+	defaultAsyncBuffer = 1024
+)
+
+var (
+	ErrBufferFull     = errors.New("kafka async buffer full")
+	ErrProducerClosed = errors.New("kafka async producer closed")
+)
+
+// Callback async message delivery callback, err is nil if message delivered
+type Callback func(message *sarama.ProducerMessage, err error)
+
+type asyncMetadata struct {
+	metadata interface{}
+	callback Callback
+	span     opentracing.Span
+}
+
+type asyncProducer struct {
+	name     string
+	producer sarama.AsyncProducer
+	policy   string
+	buffer   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+	done   sync.WaitGroup
+}
+
+func newAsyncProducer(name string, producer sarama.AsyncProducer, buffer int, policy string) *asyncProducer {
+	if buffer <= 0 {
+		buffer = defaultAsyncBuffer
+	}
+	if policy == "" {
+		policy = BackpressureBlock
+	}
+
+	t := &asyncProducer{
+		name:     name,
+		producer: producer,
+		policy:   policy,
+		buffer:   make(chan struct{}, buffer),
+	}
+
+	t.done.Add(2)
+	go func() {
+		defer t.done.Done()
+		for msg := range producer.Successes() {
+			t.complete(msg, nil)
+		}
+	}()
+	go func() {
+		defer t.done.Done()
+		for it := range producer.Errors() {
+			t.complete(it.Msg, it.Err)
+		}
+	}()
+
+	return t
+}
+
+func (t *asyncProducer) send(ctx context.Context, message *sarama.ProducerMessage, callback Callback) error {
+	if err := t.acquire(ctx); err != nil {
+		if err == ErrBufferFull && t.policy == BackpressureDrop {
+			asyncMessages.WithLabelValues(t.name, message.Topic, statusDropped).Inc()
+			if callback != nil {
+				callback(message, err)
+			}
+			return nil
+		}
+		return err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		<-t.buffer
+		return ErrProducerClosed
+	}
+
+	meta := &asyncMetadata{metadata: message.Metadata, callback: callback}
+
+	sendCtx := ctx
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		meta.span, _ = opentracing.StartSpanFromContext(opentracing.ContextWithSpan(context.Background(), span), "kafka_async_send")
+		ext.SpanKindProducer.Set(meta.span)
+		meta.span.SetTag("topic", message.Topic)
+		sendCtx = opentracing.ContextWithSpan(ctx, meta.span)
+	}
+	InjectHeaders(sendCtx, message)
+
+	message.Metadata = meta
+	asyncInflight.WithLabelValues(t.name).Inc()
+	t.producer.Input() <- message
+	return nil
+}
+
+func (t *asyncProducer) acquire(ctx context.Context) error {
+	if t.policy == BackpressureBlock {
+		select {
+		case t.buffer <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case t.buffer <- struct{}{}:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+func (t *asyncProducer) complete(message *sarama.ProducerMessage, err error) {
+	meta, ok := message.Metadata.(*asyncMetadata)
+	if !ok {
+		return
+	}
+	message.Metadata = meta.metadata
+
+	<-t.buffer
+	asyncInflight.WithLabelValues(t.name).Dec()
+
+	status := statusSuccess
+	if err != nil {
+		status = statusFailed
+		log.Warn("kafka async send", zap.String("name", t.name), zap.String("topic", message.Topic), zap.Error(err))
+	}
+	asyncMessages.WithLabelValues(t.name, message.Topic, status).Inc()
+	observeProduced(t.name, message.Topic, err)
+
+	if meta.span != nil {
+		if err != nil {
+			ext.Error.Set(meta.span, true)
+			meta.span.LogKV("client_name", t.name, "err", err)
+		}
+		meta.span.Finish()
+	}
+
+	if meta.callback != nil {
+		defer func() {
+			if x := recover(); x != nil {
+				log.Error("kafka async callback panic", zap.Any("err", x), zap.ByteString("stack", debug.Stack()))
+			}
+		}()
+		meta.callback(message, err)
+	}
+}
+
+// close stop accepting messages, flush buffered messages and wait for all the callbacks
+func (t *asyncProducer) close() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	t.mu.Unlock()
+
+	t.producer.AsyncClose()
+	t.done.Wait()
+}
+
+// AsyncSend send message to kafka asynchronously, callback (optional) will be called when message delivered or failed
+//
+// in-flight messages are bounded by mq asyncBuffer config, and the backpressure policy (block, drop, error)
+// is configured by mq asyncPolicy config. buffered messages are flushed on shutdown
+func (t *defaultKafka) AsyncSend(ctx context.Context, message *sarama.ProducerMessage, callback Callback) error {
+	if err := t.initializeAsyncProducer(); err != nil {
+		return err
+	}
+	return t.asyncProducer.send(ctx, message, callback)
+}
+
+func (t *defaultKafka) initializeAsyncProducer() (err error) {
+	t.asyncProducerInitializeOnce.Do(func() {
+		if !t.client.Config().Producer.Return.Successes || !t.client.Config().Producer.Return.Errors {
+			err = errors.New("async producer requires Producer.Return.Successes and Producer.Return.Errors")
+			return
+		}
+
+		var producer sarama.AsyncProducer
+		if producer, err = sarama.NewAsyncProducerFromClient(t.client); err != nil {
+			return
+		}
+
+		t.asyncProducer = newAsyncProducer(t.config.Name, producer, t.config.AsyncBuffer, t.config.AsyncPolicy)
+		lifecycle.OnStop(fmt.Sprint("kafka-async-producer:", t.config.Name), func(context.Context) error {
+			t.asyncProducer.close()
+			return nil
+		}, lifecycle.WithPriority(lifecycle.PriorityClient))
+	})
+
+	if err == nil && t.asyncProducer == nil {
+		err = errors.New("async producer initialize failed")
+	}
+	return
+}
@@ -0,0 +1,63 @@
+package kafkax
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncProducer(t *testing.T) {
+	mock := mocks.NewAsyncProducer(t, NewDefaultKafkaConfig())
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(errors.New("broker down"))
+
+	p := newAsyncProducer("test", mock, 10, BackpressureError)
+
+	var (
+		mu      sync.Mutex
+		results = make(map[string]error)
+		wg      sync.WaitGroup
+	)
+	callback := func(message *sarama.ProducerMessage, err error) {
+		defer wg.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		results[message.Metadata.(string)] = err
+	}
+
+	wg.Add(2)
+	assert.NoError(t, p.send(context.Background(), &sarama.ProducerMessage{Topic: "topic", Metadata: "ok"}, callback))
+	assert.NoError(t, p.send(context.Background(), &sarama.ProducerMessage{Topic: "topic", Metadata: "fail"}, callback))
+	wg.Wait()
+
+	assert.NoError(t, results["ok"])
+	assert.EqualError(t, results["fail"], "broker down")
+
+	p.close()
+	assert.Equal(t, ErrProducerClosed, p.send(context.Background(), &sarama.ProducerMessage{Topic: "topic"}, nil))
+}
+
+func TestAsyncProducerBackpressure(t *testing.T) {
+	p := &asyncProducer{name: "test", buffer: make(chan struct{}, 1)}
+	p.buffer <- struct{}{}
+
+	p.policy = BackpressureError
+	assert.Equal(t, ErrBufferFull, p.send(context.Background(), &sarama.ProducerMessage{Topic: "topic"}, nil))
+
+	p.policy = BackpressureDrop
+	var dropped error
+	assert.NoError(t, p.send(context.Background(), &sarama.ProducerMessage{Topic: "topic"}, func(_ *sarama.ProducerMessage, err error) {
+		dropped = err
+	}))
+	assert.Equal(t, ErrBufferFull, dropped)
+
+	p.policy = BackpressureBlock
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, p.send(ctx, &sarama.ProducerMessage{Topic: "topic"}, nil))
+}
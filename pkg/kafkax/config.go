@@ -0,0 +1,247 @@
+package kafkax
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/xdg-go/scram"
+)
+
+// saslConfig sasl authentication, e.g.
+//
+//	sasl:
+//	  mechanism: SCRAM-SHA-512
+//	  user: user
+//	  password: password
+type saslConfig struct {
+	Mechanism string `yaml:"mechanism"` // PLAIN (default), SCRAM-SHA-256, SCRAM-SHA-512
+	User      string `yaml:"user"`
+	Password  string `yaml:"password"`
+}
+
+// tlsConfig tls connection, server certificate verified by system roots if ca not set
+type tlsConfig struct {
+	Enable             bool   `yaml:"enable"`
+	CA                 string `yaml:"ca"`                 // CA file for verify broker certificate
+	Cert               string `yaml:"cert"`               // client certificate file, optional
+	Key                string `yaml:"key"`                // client private key file, optional
+	ServerName         string `yaml:"serverName"`         // server name for verify broker certificate
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"` // skip verify broker certificate, testing only
+}
+
+type producerConfig struct {
+	Compression     string `yaml:"compression"`     // none (default), gzip, snappy, lz4, zstd
+	RequiredAcks    string `yaml:"requiredAcks"`    // none, local (default), all
+	Idempotent      bool   `yaml:"idempotent"`      // idempotent producer, requires requiredAcks all and kafka 0.11+
+	MaxMessageBytes int    `yaml:"maxMessageBytes"` // default 10MB
+}
+
+type consumerConfig struct {
+	InitialOffset     string        `yaml:"initialOffset"`     // newest (default), oldest
+	SessionTimeout    time.Duration `yaml:"sessionTimeout"`    // group session timeout, default 10s
+	HeartbeatInterval time.Duration `yaml:"heartbeatInterval"` // group heartbeat interval, default 3s
+	RebalanceTimeout  time.Duration `yaml:"rebalanceTimeout"`  // group rebalance timeout, default 60s
+	Rebalance         string        `yaml:"rebalance"`         // rebalance strategy: range (default), roundrobin, sticky
+}
+
+// NewKafkaConfig create sarama config of mq config with name, base on NewDefaultKafkaConfig
+func NewKafkaConfig(name string) (*sarama.Config, error) {
+	c, ok := configMap[name]
+	if !ok {
+		return nil, errors.Errorf("configuration not found, name: %v", name)
+	}
+	return c.saramaConfig()
+}
+
+func (t mqConfig) saramaConfig() (*sarama.Config, error) {
+	config := NewDefaultKafkaConfig()
+
+	if t.Version != "" {
+		version, err := sarama.ParseKafkaVersion(t.Version)
+		if err != nil {
+			return nil, err
+		}
+		config.Version = version
+	}
+
+	if t.SASL.User != "" {
+		if err := t.SASL.apply(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.TLS.Enable {
+		tc, err := t.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tc
+	}
+
+	if err := t.Producer.apply(config); err != nil {
+		return nil, err
+	}
+
+	if err := t.Consumer.apply(config); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "kafka config, name: %v", t.Name)
+	}
+
+	return config, nil
+}
+
+func (t saslConfig) apply(config *sarama.Config) error {
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = t.User
+	config.Net.SASL.Password = t.Password
+	config.Net.SASL.Handshake = true
+
+	switch strings.ToUpper(t.Mechanism) {
+	case "", sarama.SASLTypePlaintext:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha256.New}
+		}
+	case sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha512.New}
+		}
+	default:
+		return errors.Errorf("unsupported sasl mechanism: %v", t.Mechanism)
+	}
+	return nil
+}
+
+func (t tlsConfig) build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if t.CA != "" {
+		data, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("invalid ca: %v", t.CA)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.Cert != "" && t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func (t producerConfig) apply(config *sarama.Config) error {
+	if t.Compression != "" {
+		if err := config.Producer.Compression.UnmarshalText([]byte(strings.ToLower(t.Compression))); err != nil {
+			return err
+		}
+	}
+
+	switch strings.ToLower(t.RequiredAcks) {
+	case "":
+	case "none", "0":
+		config.Producer.RequiredAcks = sarama.NoResponse
+	case "local", "1":
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	case "all", "-1":
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	default:
+		return errors.Errorf("unsupported requiredAcks: %v", t.RequiredAcks)
+	}
+
+	if t.Idempotent {
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+	}
+
+	if t.MaxMessageBytes > 0 {
+		config.Producer.MaxMessageBytes = t.MaxMessageBytes
+	}
+
+	return nil
+}
+
+func (t consumerConfig) apply(config *sarama.Config) error {
+	switch strings.ToLower(t.InitialOffset) {
+	case "", "newest":
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "oldest":
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return errors.Errorf("unsupported initialOffset: %v", t.InitialOffset)
+	}
+
+	if t.SessionTimeout > 0 {
+		config.Consumer.Group.Session.Timeout = t.SessionTimeout
+	}
+	if t.HeartbeatInterval > 0 {
+		config.Consumer.Group.Heartbeat.Interval = t.HeartbeatInterval
+	}
+	if t.RebalanceTimeout > 0 {
+		config.Consumer.Group.Rebalance.Timeout = t.RebalanceTimeout
+	}
+
+	switch strings.ToLower(t.Rebalance) {
+	case "", "range":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRange}
+	case "roundrobin":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRoundRobin}
+	case "sticky":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategySticky}
+	default:
+		return errors.Errorf("unsupported rebalance strategy: %v", t.Rebalance)
+	}
+
+	return nil
+}
+
+// scramClient sarama scram client implementation
+type scramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (t *scramClient) Begin(userName, password, authzID string) (err error) {
+	t.Client, err = t.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	t.ClientConversation = t.Client.NewConversation()
+	return nil
+}
+
+func (t *scramClient) Step(challenge string) (string, error) {
+	return t.ClientConversation.Step(challenge)
+}
+
+func (t *scramClient) Done() bool {
+	return t.ClientConversation.Done()
+}
@@ -0,0 +1,71 @@
+package kafkax
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKafkaConfig(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(`
+mq:
+  - name: secure
+    version: 2.8.0
+    broker:
+      - 127.0.0.1:9093
+    sasl:
+      mechanism: SCRAM-SHA-512
+      user: user
+      password: password
+    tls:
+      enable: true
+      serverName: kafka.local
+    producer:
+      compression: zstd
+      idempotent: true
+      maxMessageBytes: 1048576
+    consumer:
+      initialOffset: oldest
+      sessionTimeout: 30s
+      heartbeatInterval: 5s
+      rebalance: sticky
+  - name: invalid
+    broker:
+      - 127.0.0.1:9092
+    producer:
+      requiredAcks: some
+`)))
+	Config(v)
+
+	config, err := NewKafkaConfig("secure")
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.V2_8_0_0, config.Version)
+	assert.True(t, config.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.NotNil(t, config.Net.SASL.SCRAMClientGeneratorFunc())
+	assert.True(t, config.Net.TLS.Enable)
+	assert.Equal(t, "kafka.local", config.Net.TLS.Config.ServerName)
+	assert.Equal(t, sarama.CompressionZSTD, config.Producer.Compression)
+	assert.True(t, config.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Equal(t, 1, config.Net.MaxOpenRequests)
+	assert.Equal(t, 1048576, config.Producer.MaxMessageBytes)
+	assert.Equal(t, sarama.OffsetOldest, config.Consumer.Offsets.Initial)
+	assert.Equal(t, time.Second*30, config.Consumer.Group.Session.Timeout)
+	assert.Equal(t, time.Second*5, config.Consumer.Group.Heartbeat.Interval)
+	assert.Equal(t, []sarama.BalanceStrategy{sarama.BalanceStrategySticky}, config.Consumer.Group.Rebalance.GroupStrategies)
+
+	_, err = NewKafkaConfig("invalid")
+	assert.EqualError(t, err, "unsupported requiredAcks: some")
+
+	_, err = NewKafkaConfig("not-found")
+	assert.Error(t, err)
+}
@@ -0,0 +1,469 @@
+package kafkax
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	HeaderDeadLetterTopic     = "x-dead-letter-topic"     // original topic of dead letter message
+	HeaderDeadLetterPartition = "x-dead-letter-partition" // original partition of dead letter message
+	HeaderDeadLetterOffset    = "x-dead-letter-offset"    // original offset of dead letter message
+	HeaderDeadLetterGroup     = "x-dead-letter-group"     // consumer group of dead letter message
+	HeaderDeadLetterError     = "x-dead-letter-error"     // last handler error of dead letter message
+)
+
+// Message consumed kafka message
+type Message struct {
+	*sarama.ConsumerMessage
+
+	// Group consumer group
+	Group string
+
+	// Attempt delivery attempt in current process, start from 1
+	Attempt int
+}
+
+// Handler handle consumed message, message will be retried if error returned
+type Handler func(ctx context.Context, message *Message) error
+
+// HandlerOption topic handler option
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	concurrency int
+	maxRetries  int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	deadLetter  string
+}
+
+// WithConcurrency max in-flight messages of each partition, default 1 (in order)
+//
+// offset is only committed when all the previous messages of the partition are handled
+func WithConcurrency(n int) HandlerOption {
+	return func(o *handlerOptions) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithRetry retry failed message at most maxRetries times, with exponential backoff
+// start from backoff and capped by maxBackoff, default 3 retries, 500ms backoff and 10s max backoff
+func WithRetry(maxRetries int, backoff, maxBackoff time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.maxRetries = maxRetries
+		o.backoff = backoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithDeadLetter send message to dead letter topic when all the retries failed,
+// otherwise the message will be dropped with error log. sending dead letter is retried as handler,
+// the session is restarted and the message redelivered if dead letter still not sent
+func WithDeadLetter(topic string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.deadLetter = topic
+	}
+}
+
+func newHandlerOptions(options ...HandlerOption) handlerOptions {
+	o := handlerOptions{
+		concurrency: 1,
+		maxRetries:  3,
+		backoff:     time.Millisecond * 500,
+		maxBackoff:  time.Second * 10,
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+func (t *handlerOptions) backoffOf(retry int) time.Duration {
+	d := t.backoff
+	for i := 1; i < retry && d < t.maxBackoff; i++ {
+		d *= 2
+	}
+	if t.maxBackoff > 0 && d > t.maxBackoff {
+		d = t.maxBackoff
+	}
+	return d
+}
+
+// Consumer is a kafka consumer group with per topic handler
+type Consumer interface {
+	// Handle register topic handler, should be called before Start
+	Handle(topic string, handler Handler, options ...HandlerOption)
+
+	// Start start consume in background, consumer will be closed on shutdown
+	Start(ctx context.Context) error
+
+	// Close stop consume and wait for in-flight messages
+	Close() error
+}
+
+type topicHandler struct {
+	handler Handler
+	options handlerOptions
+}
+
+type defaultConsumer struct {
+	client   Client
+	group    string
+	handlers map[string]*topicHandler
+
+	mu        sync.Mutex
+	consumer  sarama.ConsumerGroup
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewConsumer create a consumer of group with kafka client
+func NewConsumer(client Client, group string) Consumer {
+	return &defaultConsumer{
+		client:   client,
+		group:    group,
+		handlers: make(map[string]*topicHandler, 4),
+	}
+}
+
+// Handle register topic handler, should be called before Start
+func (t *defaultConsumer) Handle(topic string, handler Handler, options ...HandlerOption) {
+	h := &topicHandler{
+		handler: handler,
+		options: newHandlerOptions(options...),
+	}
+	t.handlers[topic] = h
+}
+
+// Start start consume in background, consumer will be closed on shutdown
+func (t *defaultConsumer) Start(ctx context.Context) error {
+	if t.group == "" || len(t.handlers) == 0 {
+		return errors.New("group and handlers required")
+	}
+
+	consumer, err := sarama.NewConsumerGroupFromClient(t.group, t.client.Get())
+	if err != nil {
+		return err
+	}
+
+	topics := make([]string, 0, len(t.handlers))
+	for topic := range t.handlers {
+		topics = append(topics, topic)
+	}
+
+	l := log.Named("kafka consumer").With(zap.String("groupId", t.group), zap.Strings("topics", topics))
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	t.consumer, t.cancel, t.done = consumer, cancel, make(chan struct{})
+	t.mu.Unlock()
+
+	go func() {
+		for it := range consumer.Errors() {
+			l.Warn("client error", zap.Error(it))
+		}
+	}()
+
+	go func() {
+		defer close(t.done)
+		name := clientName(t.client)
+		handler := newInstrumentedHandler(name, t.group,
+			&consumerGroupHandler{name: name, group: t.group, handlers: t.handlers, client: t.client})
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				// pass
+			}
+			l.Debug("start consume")
+			if err := consumer.Consume(ctx, topics, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				l.Warn("consume", zap.Error(err))
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second * 5):
+				}
+			}
+		}
+	}()
+
+	lifecycle.OnStop(fmt.Sprint("kafka-consumer:", t.group), func(context.Context) error {
+		return t.Close()
+	}, lifecycle.WithPriority(lifecycle.PriorityWorker))
+
+	return nil
+}
+
+// Close stop consume and wait for in-flight messages
+func (t *defaultConsumer) Close() (err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.consumer == nil {
+		return nil
+	}
+
+	t.closeOnce.Do(func() {
+		t.cancel()
+		<-t.done
+		err = t.consumer.Close()
+	})
+	return
+}
+
+type consumerGroupHandler struct {
+	name     string
+	group    string
+	handlers map[string]*topicHandler
+	client   Client
+}
+
+func (t *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (t *consumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim consume messages of claim, returns error to restart the session if a message could be neither
+// handled nor sent to dead letter topic, otherwise offsets of later messages could not be marked
+func (t *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	h, ok := t.handlers[claim.Topic()]
+	if !ok {
+		return errors.Errorf("handler not found, topic: %v", claim.Topic())
+	}
+
+	ctx, cancel := context.WithCancel(session.Context())
+	defer cancel()
+
+	tracker := &offsetTracker{session: session}
+	sem := make(chan struct{}, h.options.concurrency)
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failed   error
+	)
+
+	consume := func() {
+		for {
+			select {
+			case msg, ok := <-claim.Messages():
+				if !ok {
+					return
+				}
+
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				if ctx.Err() != nil {
+					return
+				}
+
+				pending := tracker.add(msg)
+				wg.Add(1)
+				go func() {
+					defer func() {
+						<-sem
+						wg.Done()
+					}()
+					done, err := t.process(ctx, h, msg)
+					if err != nil {
+						failOnce.Do(func() {
+							failed = err
+							cancel()
+						})
+						return
+					}
+					if done {
+						tracker.complete(pending)
+					}
+				}()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	consume()
+	wg.Wait()
+	return failed
+}
+
+// process handle message with retries, returns whether the message could be marked as consumed,
+// error returned if the message failed and could not be sent to dead letter topic
+func (t *consumerGroupHandler) process(ctx context.Context, h *topicHandler, msg *sarama.ConsumerMessage) (bool, error) {
+	l := log.Named("kafka consumer")
+	fields := messageFields(t.group, msg)
+
+	var err error
+	for attempt := 1; attempt <= h.options.maxRetries+1; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(h.options.backoffOf(attempt - 1)):
+			case <-ctx.Done():
+				return false, nil
+			}
+		}
+
+		if err = t.handle(ctx, h, &Message{ConsumerMessage: msg, Group: t.group, Attempt: attempt}); err == nil {
+			return true, nil
+		}
+
+		l.Warn("handle message", append(fields, zap.Int("attempt", attempt), zap.Error(err))...)
+	}
+
+	// session closed, message will be redelivered
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	if h.options.deadLetter == "" {
+		l.Error("drop message", append(fields, zap.Error(err))...)
+		return true, nil
+	}
+
+	var e error
+	for attempt := 1; attempt <= h.options.maxRetries+1; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(h.options.backoffOf(attempt - 1)):
+			case <-ctx.Done():
+				return false, nil
+			}
+		}
+
+		if e = t.sendDeadLetter(ctx, h.options.deadLetter, msg, err); e == nil {
+			return true, nil
+		}
+
+		l.Warn("send dead letter", append(fields,
+			zap.String("deadLetter", h.options.deadLetter), zap.Int("attempt", attempt), zap.Error(e))...)
+	}
+
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	return false, errors.Wrapf(e, "send dead letter of %s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+func (t *consumerGroupHandler) handle(ctx context.Context, h *topicHandler, message *Message) (err error) {
+	start := time.Now()
+	span, ctx := StartSpanFromMessage(ctx, message.ConsumerMessage, "kafka_consume")
+	span.SetTag("group", t.group)
+	span.SetTag("attempt", message.Attempt)
+	defer span.Finish()
+
+	defer func() {
+		if x := recover(); x != nil {
+			err = errors.Errorf("panic: %v", x)
+			log.For(ctx).Error("handle message panic", zap.Any("err", x), zap.ByteString("stack", debug.Stack()))
+		}
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogKV("err", err)
+		}
+		observeHandle(t.name, t.group, message.Topic, start, err)
+	}()
+
+	return h.handler(ctx, message)
+}
+
+func (t *consumerGroupHandler) sendDeadLetter(ctx context.Context, topic string, msg *sarama.ConsumerMessage, cause error) error {
+	return t.client.SendMessage(ctx, newDeadLetterMessage(topic, t.group, msg, cause))
+}
+
+// newDeadLetterMessage copy of consumed message to dead letter topic, with headers of original position and error
+func newDeadLetterMessage(topic, group string, msg *sarama.ConsumerMessage, cause error) *sarama.ProducerMessage {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+5)
+	for _, it := range msg.Headers {
+		if it != nil {
+			headers = append(headers, *it)
+		}
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderDeadLetterTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderDeadLetterPartition), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		sarama.RecordHeader{Key: []byte(HeaderDeadLetterOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(HeaderDeadLetterGroup), Value: []byte(group)},
+		sarama.RecordHeader{Key: []byte(HeaderDeadLetterError), Value: []byte(cause.Error())},
+	)
+
+	message := &sarama.ProducerMessage{
+		Topic:   topic,
+		Headers: headers,
+		Value:   sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		message.Key = sarama.ByteEncoder(msg.Key)
+	}
+	return message
+}
+
+// messageFields log fields of consumed message, which are passed to each log call,
+// as loggers derived by With from the same named logger share fields slice and are not safe for concurrent use
+func messageFields(group string, msg *sarama.ConsumerMessage) []zap.Field {
+	return []zap.Field{
+		zap.String("groupId", group),
+		zap.String("topic", msg.Topic),
+		zap.Int32("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+	}
+}
+
+// offsetTracker mark the offset of partition only when all the previous messages are done
+type offsetTracker struct {
+	mu      sync.Mutex
+	session sarama.ConsumerGroupSession
+	pending []*pendingMessage
+}
+
+type pendingMessage struct {
+	message *sarama.ConsumerMessage
+	done    bool
+}
+
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) *pendingMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := &pendingMessage{message: msg}
+	t.pending = append(t.pending, p)
+	return p
+}
+
+func (t *offsetTracker) complete(p *pendingMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p.done = true
+
+	var last *sarama.ConsumerMessage
+	for len(t.pending) > 0 && t.pending[0].done {
+		last = t.pending[0].message
+		t.pending = t.pending[1:]
+	}
+	if last != nil {
+		t.session.MarkMessage(last, "")
+	}
+}
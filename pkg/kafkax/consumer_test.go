@@ -0,0 +1,189 @@
+package kafkax
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	Client
+	mu       sync.Mutex
+	messages []*sarama.ProducerMessage
+	fails    int // number of SendMessage failures before success, -1 always fail
+}
+
+func (t *fakeClient) SendMessage(_ context.Context, message *sarama.ProducerMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fails != 0 {
+		if t.fails > 0 {
+			t.fails--
+		}
+		return errors.New("send failed")
+	}
+	t.messages = append(t.messages, message)
+	return nil
+}
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (t *fakeSession) Context() context.Context {
+	return t.ctx
+}
+
+func (t *fakeSession) Commit() {}
+
+func (t *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.marked = append(t.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	topic     string
+	messages  chan *sarama.ConsumerMessage
+	highWater int64
+}
+
+func (t *fakeClaim) Topic() string {
+	return t.topic
+}
+
+func (t *fakeClaim) Partition() int32 {
+	return 0
+}
+
+func (t *fakeClaim) HighWaterMarkOffset() int64 {
+	return t.highWater
+}
+
+func (t *fakeClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return t.messages
+}
+
+func consumeClaim(t *testing.T, h *consumerGroupHandler, topic string, n int) *fakeSession {
+	session, err := consumeClaimErr(h, topic, n)
+	assert.NoError(t, err)
+	return session
+}
+
+func consumeClaimErr(h *consumerGroupHandler, topic string, n int) (*fakeSession, error) {
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{topic: topic, messages: make(chan *sarama.ConsumerMessage, n)}
+	for i := 0; i < n; i++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: topic, Offset: int64(i), Value: []byte("hello")}
+	}
+	close(claim.messages)
+	return session, h.ConsumeClaim(session, claim)
+}
+
+func TestConsumerRetryAndDeadLetter(t *testing.T) {
+	client := &fakeClient{}
+	c := NewConsumer(client, "group").(*defaultConsumer)
+
+	var mu sync.Mutex
+	attempts := make(map[int64]int)
+	c.Handle("topic", func(ctx context.Context, message *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[message.Offset] = message.Attempt
+		switch message.Offset {
+		case 1:
+			return errors.New("always fail")
+		case 2:
+			if message.Attempt < 2 {
+				panic("first attempt panic")
+			}
+		}
+		return nil
+	}, WithRetry(2, time.Millisecond, time.Millisecond*2), WithDeadLetter("topic.dlq"))
+
+	h := &consumerGroupHandler{group: "group", handlers: c.handlers, client: client}
+	session := consumeClaim(t, h, "topic", 3)
+
+	assert.Equal(t, map[int64]int{0: 1, 1: 3, 2: 2}, attempts)
+	assert.Equal(t, []int64{0, 1, 2}, session.marked)
+
+	assert.Len(t, client.messages, 1)
+	dlq := client.messages[0]
+	assert.Equal(t, "topic.dlq", dlq.Topic)
+	headers := make(map[string]string)
+	for _, it := range dlq.Headers {
+		headers[string(it.Key)] = string(it.Value)
+	}
+	assert.Equal(t, "topic", headers[HeaderDeadLetterTopic])
+	assert.Equal(t, "1", headers[HeaderDeadLetterOffset])
+	assert.Equal(t, "always fail", headers[HeaderDeadLetterError])
+}
+
+func TestConsumerDeadLetterFailed(t *testing.T) {
+	client := &fakeClient{}
+	c := NewConsumer(client, "group").(*defaultConsumer)
+
+	var mu sync.Mutex
+	var handled []int64
+	c.Handle("topic", func(ctx context.Context, message *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if message.Offset == 1 {
+			return errors.New("always fail")
+		}
+		handled = append(handled, message.Offset)
+		return nil
+	}, WithRetry(1, time.Millisecond, time.Millisecond), WithDeadLetter("topic.dlq"))
+
+	h := &consumerGroupHandler{group: "group", handlers: c.handlers, client: client}
+
+	// dead letter sent after retry, later offsets are committed
+	client.fails = 1
+	session := consumeClaim(t, h, "topic", 3)
+	assert.Equal(t, []int64{0, 1, 2}, session.marked)
+	assert.Len(t, client.messages, 1)
+
+	// dead letter never sent, claim exits with error to restart session, nothing marked after the failed one
+	client.fails = -1
+	handled = nil
+	session, err := consumeClaimErr(h, "topic", 3)
+	assert.Error(t, err)
+	assert.Equal(t, []int64{0}, session.marked)
+	assert.Equal(t, []int64{0}, handled)
+}
+
+func TestConsumerConcurrencyMarkInOrder(t *testing.T) {
+	c := NewConsumer(&fakeClient{}, "group").(*defaultConsumer)
+	c.Handle("topic", func(ctx context.Context, message *Message) error {
+		// earlier messages finish later
+		time.Sleep(time.Millisecond * time.Duration(10-message.Offset))
+		return nil
+	}, WithConcurrency(5))
+
+	h := &consumerGroupHandler{group: "group", handlers: c.handlers}
+	session := consumeClaim(t, h, "topic", 10)
+
+	last := int64(-1)
+	for _, offset := range session.marked {
+		assert.Greater(t, offset, last)
+		last = offset
+	}
+	assert.Equal(t, int64(9), last)
+}
+
+func TestBackoff(t *testing.T) {
+	o := handlerOptions{backoff: time.Second, maxBackoff: time.Second * 5}
+	assert.Equal(t, time.Second, o.backoffOf(1))
+	assert.Equal(t, time.Second*2, o.backoffOf(2))
+	assert.Equal(t, time.Second*4, o.backoffOf(3))
+	assert.Equal(t, time.Second*5, o.backoffOf(4))
+}
@@ -0,0 +1,106 @@
+package kafkax
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/xinpianchang/xservice/core"
+)
+
+const (
+	HeaderXRequestID = "x-request-id" // message header for request id
+)
+
+// InjectHeaders inject span context and request id of ctx into message headers
+func InjectHeaders(ctx context.Context, message *sarama.ProducerMessage) {
+	if ctx == nil {
+		return
+	}
+
+	carrier := &producerMessageCarrier{message: message}
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		_ = span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier)
+	}
+
+	if requestId := ctx.Value(core.ContextHeaderXRequestID); requestId != nil {
+		carrier.Set(HeaderXRequestID, fmt.Sprint(requestId))
+	}
+}
+
+// StartSpanFromMessage start a consumer span as child of the span context in message headers,
+// and returns context with the span and request id, so that log.For(ctx) logs the same trace_id as producer
+//
+// span should be finished by caller
+func StartSpanFromMessage(ctx context.Context, msg *sarama.ConsumerMessage, operationName string) (opentracing.Span, context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	carrier := consumerMessageCarrier(msg.Headers)
+
+	options := []opentracing.StartSpanOption{
+		ext.SpanKindConsumer,
+		opentracing.Tags{
+			"topic":     msg.Topic,
+			"partition": msg.Partition,
+			"offset":    msg.Offset,
+		},
+	}
+	if sc, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, carrier); err == nil && sc != nil {
+		options = append(options, opentracing.ChildOf(sc))
+	}
+
+	if requestId := carrier.Get(HeaderXRequestID); requestId != "" {
+		ctx = context.WithValue(ctx, core.ContextHeaderXRequestID, requestId)
+	}
+
+	span := opentracing.StartSpan(operationName, options...)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
+
+// producerMessageCarrier opentracing text map writer of producer message headers
+type producerMessageCarrier struct {
+	message *sarama.ProducerMessage
+}
+
+// Set conforms to the TextMapWriter interface, existing header with the same key will be replaced
+func (t *producerMessageCarrier) Set(key, val string) {
+	for i, it := range t.message.Headers {
+		if string(it.Key) == key {
+			t.message.Headers[i].Value = []byte(val)
+			return
+		}
+	}
+	t.message.Headers = append(t.message.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(val)})
+}
+
+// consumerMessageCarrier opentracing text map reader of consumer message headers
+type consumerMessageCarrier []*sarama.RecordHeader
+
+// ForeachKey conforms to the TextMapReader interface
+func (t consumerMessageCarrier) ForeachKey(handler func(key, val string) error) error {
+	for _, it := range t {
+		if it == nil {
+			continue
+		}
+		if err := handler(string(it.Key), string(it.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get get header value by key
+func (t consumerMessageCarrier) Get(key string) string {
+	for _, it := range t {
+		if it != nil && string(it.Key) == key {
+			return string(it.Value)
+		}
+	}
+	return ""
+}
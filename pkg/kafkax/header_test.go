@@ -0,0 +1,43 @@
+package kafkax
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xinpianchang/xservice/core"
+	"github.com/xinpianchang/xservice/pkg/tracingx"
+)
+
+func TestHeaderPropagation(t *testing.T) {
+	v := viper.New()
+	v.Set("tracing.provider", tracingx.ProviderOpenTelemetry)
+	v.Set("tracing.exporter", tracingx.ExporterMemory)
+	tracingx.Config(v)
+
+	span, ctx := opentracing.StartSpanFromContext(context.Background(), "producer")
+	defer span.Finish()
+	ctx = context.WithValue(ctx, core.ContextHeaderXRequestID, "request-1")
+
+	message := &sarama.ProducerMessage{Topic: "topic"}
+	InjectHeaders(ctx, message)
+	// inject twice should not duplicate headers
+	InjectHeaders(ctx, message)
+	assert.Len(t, message.Headers, 2)
+
+	consumed := &sarama.ConsumerMessage{Topic: "topic"}
+	for i := range message.Headers {
+		consumed.Headers = append(consumed.Headers, &message.Headers[i])
+	}
+
+	consumerSpan, consumerCtx := StartSpanFromMessage(context.Background(), consumed, "consumer")
+	defer consumerSpan.Finish()
+
+	assert.Equal(t, tracingx.GetTraceID(ctx), tracingx.GetTraceID(consumerCtx))
+	assert.NotEqual(t, tracingx.GetSpanID(ctx), tracingx.GetSpanID(consumerCtx))
+	assert.Equal(t, "request-1", consumerCtx.Value(core.ContextHeaderXRequestID))
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
+	"github.com/xinpianchang/xservice/pkg/health"
 	"github.com/xinpianchang/xservice/pkg/log"
 	"github.com/xinpianchang/xservice/pkg/netx"
 )
@@ -22,12 +23,22 @@ import (
 var (
 	configMap = make(map[string]mqConfig, 8)
 	clientID  int32
+	instances int32 // sequence of clients, key of health checker
 )
 
 type mqConfig struct {
-	Name    string   `yaml:"name"`    // config name, should be unique
-	Version string   `yaml:"version"` // kafka cluster version
-	Broker  []string `yaml:"broker"`  // kafka broker list
+	Name        string   `yaml:"name"`        // config name, should be unique
+	Version     string   `yaml:"version"`     // kafka cluster version
+	Broker      []string `yaml:"broker"`      // kafka broker list
+	AsyncBuffer int      `yaml:"asyncBuffer"` // max in-flight messages of async producer, default 1024
+	AsyncPolicy string   `yaml:"asyncPolicy"` // backpressure policy when async buffer full: block (default), drop, error
+
+	TransactionalID string `yaml:"transactionalId"` // transactional id of transactional producer, environment variables expanded, stable per instance
+
+	SASL     saslConfig     `yaml:"sasl"`     // sasl authentication
+	TLS      tlsConfig      `yaml:"tls"`      // tls connection
+	Producer producerConfig `yaml:"producer"` // producer settings
+	Consumer consumerConfig `yaml:"consumer"` // consumer settings
 }
 
 func Config(v *viper.Viper) {
@@ -37,6 +48,11 @@ func Config(v *viper.Viper) {
 	}
 
 	for _, it := range configs {
+		switch it.AsyncPolicy {
+		case "", BackpressureBlock, BackpressureDrop, BackpressureError:
+		default:
+			log.Fatal("kafka config, invalid asyncPolicy", zap.String("name", it.Name), zap.String("asyncPolicy", it.AsyncPolicy))
+		}
 		configMap[it.Name] = it
 	}
 }
@@ -49,10 +65,13 @@ type Client interface {
 	// Close close kafka client
 	Close() error
 
-	// SendMessage send message to kafka
+	// SendMessage send message to kafka, span context and request id will be injected into message headers
 	SendMessage(ctx context.Context, message *sarama.ProducerMessage) error
 
-	// GroupConsume consume kafka group
+	// AsyncSend send message to kafka asynchronously, callback (optional) will be called when message delivered or failed
+	AsyncSend(ctx context.Context, message *sarama.ProducerMessage, callback Callback) error
+
+	// GroupConsume consume kafka group with raw sarama handler, see NewConsumer for handler with retry and dead letter
 	GroupConsume(ctx context.Context, group string, topics []string, handler sarama.ConsumerGroupHandler) error
 }
 
@@ -61,9 +80,13 @@ type defaultKafka struct {
 	client                 sarama.Client
 	producerInitializeOnce sync.Once
 	producer               sarama.SyncProducer
+	healthName             string
+
+	asyncProducerInitializeOnce sync.Once
+	asyncProducer               *asyncProducer
 }
 
-// New create a kafka client
+// New create a kafka client, sarama config created by mq config if cfg not specified
 func New(name string, cfg ...*sarama.Config) (Client, error) {
 	c, ok := configMap[name]
 	if !ok {
@@ -79,10 +102,11 @@ func New(name string, cfg ...*sarama.Config) (Client, error) {
 		config = cfg[0]
 	}
 	if config == nil {
-		config = NewDefaultKafkaConfig()
-	}
-
-	if version, err := sarama.ParseKafkaVersion(c.Version); err != nil {
+		var err error
+		if config, err = c.saramaConfig(); err != nil {
+			log.Fatal("kafka config", zap.Error(err), zap.String("name", c.Name))
+		}
+	} else if version, err := sarama.ParseKafkaVersion(c.Version); err != nil {
 		log.Fatal("kafka config", zap.Error(err))
 	} else {
 		config.Version = version
@@ -98,6 +122,16 @@ func New(name string, cfg ...*sarama.Config) (Client, error) {
 		kafka.client = client
 	}
 
+	// keyed per instance, clients of the same config (or sharing clientId) do not replace checkers of each other
+	kafka.healthName = fmt.Sprint("kafka:", c.Name, ":", atomic.AddInt32(&instances, 1))
+	health.Register(kafka.healthName, func(context.Context) error {
+		if kafka.client.Closed() {
+			return errors.New("client closed")
+		}
+		_, err := kafka.client.Controller()
+		return err
+	})
+
 	return kafka, nil
 }
 
@@ -126,6 +160,14 @@ func kafkaClientID() string {
 	return fmt.Sprint("sarama", "_", hostname, "_", os.Getpid(), "_", clientID)
 }
 
+// clientName returns mq config name of client for metrics, empty if client is not created by New
+func clientName(client Client) string {
+	if c, ok := client.(*defaultKafka); ok {
+		return c.config.Name
+	}
+	return ""
+}
+
 // Get get kafka client
 func (t *defaultKafka) Get() sarama.Client {
 	return t.client
@@ -133,6 +175,10 @@ func (t *defaultKafka) Get() sarama.Client {
 
 // Close close kafka client
 func (t *defaultKafka) Close() error {
+	health.Unregister(t.healthName)
+	if t.asyncProducer != nil {
+		t.asyncProducer.close()
+	}
 	if !t.client.Closed() {
 		return t.client.Close()
 	}
@@ -145,9 +191,11 @@ func (t *defaultKafka) SendMessage(ctx context.Context, message *sarama.Producer
 		return err
 	}
 
+	sendCtx := ctx
 	if span := opentracing.SpanFromContext(ctx); span != nil {
-		ctx = opentracing.ContextWithSpan(context.Background(), span)
-		span, _ = opentracing.StartSpanFromContext(ctx, "kafka_send")
+		span, _ = opentracing.StartSpanFromContext(opentracing.ContextWithSpan(context.Background(), span), "kafka_send")
+		ext.SpanKindProducer.Set(span)
+		span.SetTag("topic", message.Topic)
 		defer func() {
 			if err != nil {
 				ext.Error.Set(span, true)
@@ -155,9 +203,13 @@ func (t *defaultKafka) SendMessage(ctx context.Context, message *sarama.Producer
 			}
 			span.Finish()
 		}()
+		sendCtx = opentracing.ContextWithSpan(ctx, span)
 	}
 
+	InjectHeaders(sendCtx, message)
+
 	_, _, err = t.producer.SendMessage(message)
+	observeProduced(t.config.Name, message.Topic, err)
 
 	return
 }
@@ -200,7 +252,7 @@ func (t *defaultKafka) GroupConsume(ctx context.Context, group string, topics []
 				// pass
 			}
 			l.Debug("start consume")
-			err = consumer.Consume(ctx, topics, handler)
+			err = consumer.Consume(ctx, topics, newInstrumentedHandler(t.config.Name, group, handler))
 			if err != nil {
 				l.Warn("consume", zap.Error(err))
 				time.Sleep(time.Second * 5)
@@ -0,0 +1,55 @@
+package kafkax
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xinpianchang/xservice/pkg/health"
+)
+
+func kafkaChecks() []health.CheckResult {
+	var checks []health.CheckResult
+	for _, it := range health.Default().Readiness(context.Background()).Checks {
+		if strings.HasPrefix(it.Name, "kafka:health:") {
+			checks = append(checks, it)
+		}
+	}
+	return checks
+}
+
+func TestClientHealth(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+	})
+
+	configMap["health"] = mqConfig{Name: "health", Version: "2.1.0", Broker: []string{broker.Addr()}}
+
+	newClient := func() Client {
+		config := NewDefaultKafkaConfig()
+		config.ClientID = "shared"
+		client, err := New("health", config)
+		require.NoError(t, err)
+		return client
+	}
+
+	// clients sharing clientId have their own checkers
+	a, b := newClient(), newClient()
+	defer b.Close()
+	assert.Len(t, kafkaChecks(), 2)
+
+	// closing one does not unregister checker of the other
+	require.NoError(t, a.Close())
+	checks := kafkaChecks()
+	if assert.Len(t, checks, 1) {
+		assert.Equal(t, health.StatusUp, checks[0].Status)
+	}
+}
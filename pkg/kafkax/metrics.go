@@ -0,0 +1,151 @@
+package kafkax
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	metricsNamespace = "kafka"
+
+	statusSuccess = "success"
+	statusFailed  = "failed"
+	statusDropped = "dropped"
+	statusCommit  = "commit"
+	statusAbort   = "abort"
+)
+
+var (
+	asyncInflight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "producer",
+		Name:      "async_inflight",
+		Help:      "Number of in-flight async messages",
+	}, []string{"name"})
+
+	asyncMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "producer",
+		Name:      "async_messages_total",
+		Help:      "Number of async messages by delivery status",
+	}, []string{"name", "topic", "status"})
+
+	transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "producer",
+		Name:      "transactions_total",
+		Help:      "Number of transactions by result",
+	}, []string{"name", "status"})
+
+	messagesProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "producer",
+		Name:      "messages_total",
+		Help:      "Number of produced messages by status",
+	}, []string{"name", "topic", "status"})
+
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "consumer",
+		Name:      "messages_total",
+		Help:      "Number of consumed messages",
+	}, []string{"name", "group", "topic"})
+
+	handleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "consumer",
+		Name:      "handle_duration_seconds",
+		Help:      "Message handler duration",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"name", "group", "topic"})
+
+	handleFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "consumer",
+		Name:      "handle_failures_total",
+		Help:      "Number of message handler failures",
+	}, []string{"name", "group", "topic"})
+
+	rebalances = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "consumer",
+		Name:      "rebalances_total",
+		Help:      "Number of consumer group rebalances (session setup)",
+	}, []string{"name", "group"})
+
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "consumer",
+		Name:      "lag",
+		Help:      "Consumer lag of partition, computed from high water mark",
+	}, []string{"name", "group", "topic", "partition"})
+)
+
+func observeProduced(name, topic string, err error) {
+	status := statusSuccess
+	if err != nil {
+		status = statusFailed
+	}
+	messagesProduced.WithLabelValues(name, topic, status).Inc()
+}
+
+func observeHandle(name, group, topic string, start time.Time, err error) {
+	handleDuration.WithLabelValues(name, group, topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		handleFailures.WithLabelValues(name, group, topic).Inc()
+	}
+}
+
+// instrumentedHandler record consumed messages, rebalances and partition lag of consumer group handler
+type instrumentedHandler struct {
+	sarama.ConsumerGroupHandler
+	name  string
+	group string
+}
+
+func newInstrumentedHandler(name, group string, handler sarama.ConsumerGroupHandler) sarama.ConsumerGroupHandler {
+	return &instrumentedHandler{ConsumerGroupHandler: handler, name: name, group: group}
+}
+
+func (t *instrumentedHandler) Setup(session sarama.ConsumerGroupSession) error {
+	rebalances.WithLabelValues(t.name, t.group).Inc()
+	return t.ConsumerGroupHandler.Setup(session)
+}
+
+func (t *instrumentedHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	topic, partition := claim.Topic(), strconv.Itoa(int(claim.Partition()))
+	// partition may be revoked after session, drop the stale lag
+	defer consumerLag.DeleteLabelValues(t.name, t.group, topic, partition)
+
+	consumed := messagesConsumed.WithLabelValues(t.name, t.group, topic)
+	lag := consumerLag.WithLabelValues(t.name, t.group, topic, partition)
+
+	messages := make(chan *sarama.ConsumerMessage)
+	go func() {
+		defer close(messages)
+		for msg := range claim.Messages() {
+			select {
+			case messages <- msg:
+			case <-session.Context().Done():
+				return
+			}
+			consumed.Inc()
+			lag.Set(float64(claim.HighWaterMarkOffset() - msg.Offset - 1))
+		}
+	}()
+
+	return t.ConsumerGroupHandler.ConsumeClaim(session, &instrumentedClaim{ConsumerGroupClaim: claim, messages: messages})
+}
+
+type instrumentedClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (t *instrumentedClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return t.messages
+}
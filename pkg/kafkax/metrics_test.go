@@ -0,0 +1,52 @@
+package kafkax
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordHandler struct {
+	count int
+	lag   float64
+}
+
+func (t *recordHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (t *recordHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (t *recordHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for range claim.Messages() {
+		t.count++
+	}
+	t.lag = testutil.ToFloat64(consumerLag.WithLabelValues("metrics", "group", "topic", "0"))
+	return nil
+}
+
+func TestInstrumentedHandler(t *testing.T) {
+	recorder := &recordHandler{}
+	h := newInstrumentedHandler("metrics", "group", recorder)
+
+	session := &fakeSession{ctx: context.Background()}
+	assert.NoError(t, h.Setup(session))
+
+	claim := &fakeClaim{topic: "topic", messages: make(chan *sarama.ConsumerMessage, 3), highWater: 12}
+	for i := 7; i < 10; i++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: int64(i)}
+	}
+	close(claim.messages)
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+
+	assert.Equal(t, 3, recorder.count)
+	assert.Equal(t, float64(2), recorder.lag)
+	assert.Equal(t, float64(3), testutil.ToFloat64(messagesConsumed.WithLabelValues("metrics", "group", "topic")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(rebalances.WithLabelValues("metrics", "group")))
+}
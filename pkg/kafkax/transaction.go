@@ -0,0 +1,421 @@
+package kafkax
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+// Transaction kafka transaction
+type Transaction interface {
+	// Send add message to transaction, messages are sent when committing
+	Send(message *sarama.ProducerMessage)
+
+	// AddOffset commit offset of consumed message for group within transaction
+	AddOffset(message *sarama.ConsumerMessage, group string)
+}
+
+// TransformHandler transform consumed message to messages to produce
+type TransformHandler func(ctx context.Context, message *Message) ([]*sarama.ProducerMessage, error)
+
+// TransactionalProducer kafka transactional producer, configured by mq transactionalId
+type TransactionalProducer interface {
+	// Transaction run fn in a transaction, committed if fn returns nil, otherwise aborted
+	Transaction(ctx context.Context, fn func(ctx context.Context, txn Transaction) error) error
+
+	// ConsumeTransformProduce consume topics of group in background with read committed isolation,
+	// messages returned by handler are produced with the consumed offset in one transaction (exactly-once).
+	//
+	// if handler failed, the transaction is aborted and the message is retried, see WithRetry,
+	// message is sent to dead letter topic with the offset in one transaction (see WithDeadLetter),
+	// or dropped with error log when all the retries failed. WithConcurrency is ignored, messages are transformed in order
+	ConsumeTransformProduce(ctx context.Context, group string, topics []string, handler TransformHandler, options ...HandlerOption) error
+
+	// Close stop consumers and close producer
+	Close() error
+}
+
+type transaction struct {
+	messages []*sarama.ProducerMessage
+	offsets  []transactionOffset
+}
+
+type transactionOffset struct {
+	message *sarama.ConsumerMessage
+	group   string
+}
+
+// Send add message to transaction, messages are sent when committing
+func (t *transaction) Send(message *sarama.ProducerMessage) {
+	t.messages = append(t.messages, message)
+}
+
+// AddOffset commit offset of consumed message for group within transaction
+func (t *transaction) AddOffset(message *sarama.ConsumerMessage, group string) {
+	t.offsets = append(t.offsets, transactionOffset{message: message, group: group})
+}
+
+type transactionalProducer struct {
+	name     string
+	client   sarama.Client
+	producer sarama.SyncProducer
+
+	mu        sync.Mutex
+	consumers []sarama.ConsumerGroup
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewTransactionalProducer create a transactional producer with dedicated client of mq config,
+// transactional id is transactionalId config with environment variables expanded, e.g. billing-${POD_NAME}.
+//
+// transactional id must be stable across restarts and unique per instance, so a restarted instance fences its zombie
+// predecessor, whose open transaction is aborted. during graceful upgrade (tableflip) the new process fences the old one
+// on the same instance, consumers of the old process stop once its producer fenced, and messages of aborted transactions
+// are consumed again by the new process after rebalance
+func NewTransactionalProducer(name string) (TransactionalProducer, error) {
+	c, ok := configMap[name]
+	if !ok {
+		return nil, errors.Errorf("configuration not found, name: %v", name)
+	}
+
+	id := transactionalID(c.TransactionalID)
+	if id == "" {
+		return nil, errors.Errorf("transactionalId not configured, name: %v", name)
+	}
+
+	config, err := c.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Transaction.ID = id
+	config.Net.MaxOpenRequests = 1
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	config.Consumer.Offsets.AutoCommit.Enable = false
+
+	client, err := sarama.NewClient(c.Broker, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "init kafka client")
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, errors.Wrap(err, "init transactional producer")
+	}
+
+	t := &transactionalProducer{
+		name:     c.Name,
+		client:   client,
+		producer: producer,
+		cancel:   func() {},
+	}
+
+	lifecycle.OnStop(fmt.Sprint("kafka-transactional-producer:", c.Name), func(context.Context) error {
+		return t.Close()
+	}, lifecycle.WithPriority(lifecycle.PriorityWorker))
+
+	return t, nil
+}
+
+func transactionalID(id string) string {
+	return os.ExpandEnv(id)
+}
+
+// Transaction run fn in a transaction, committed if fn returns nil, otherwise aborted
+func (t *transactionalProducer) Transaction(ctx context.Context, fn func(ctx context.Context, txn Transaction) error) (err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span, ctx = opentracing.StartSpanFromContext(ctx, "kafka_transaction")
+		defer func() {
+			if err != nil {
+				ext.Error.Set(span, true)
+				span.LogKV("client_name", t.name, "err", err)
+			}
+			span.Finish()
+		}()
+	}
+
+	if err = t.producer.BeginTxn(); err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+
+	txn := &transaction{}
+	if err = t.call(ctx, txn, fn); err == nil {
+		err = t.commit(ctx, txn)
+		for _, it := range txn.messages {
+			observeProduced(t.name, it.Topic, err)
+		}
+	}
+
+	if err != nil {
+		transactions.WithLabelValues(t.name, statusAbort).Inc()
+		if e := t.abort(); e != nil {
+			log.For(ctx).Error("abort transaction", zap.String("name", t.name), zap.Error(e))
+		}
+		return
+	}
+
+	transactions.WithLabelValues(t.name, statusCommit).Inc()
+	return
+}
+
+func (t *transactionalProducer) call(ctx context.Context, txn *transaction, fn func(ctx context.Context, txn Transaction) error) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = errors.Errorf("panic: %v", x)
+			log.For(ctx).Error("transaction panic", zap.Any("err", x), zap.ByteString("stack", debug.Stack()))
+		}
+	}()
+	return fn(ctx, txn)
+}
+
+func (t *transactionalProducer) commit(ctx context.Context, txn *transaction) error {
+	if len(txn.messages) > 0 {
+		for _, message := range txn.messages {
+			InjectHeaders(ctx, message)
+		}
+		if err := t.producer.SendMessages(txn.messages); err != nil {
+			return errors.Wrap(err, "send transactional messages")
+		}
+	}
+
+	for _, it := range txn.offsets {
+		if err := t.producer.AddMessageToTxn(it.message, it.group, nil); err != nil {
+			return errors.Wrap(err, "add offset to transaction")
+		}
+	}
+
+	return errors.Wrap(t.producer.CommitTxn(), "commit transaction")
+}
+
+// fatal whether producer in fatal error, e.g. fenced by another producer with the same transactional id,
+// all the later transactions will fail
+func (t *transactionalProducer) fatal() bool {
+	return t.producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0
+}
+
+func (t *transactionalProducer) abort() error {
+	if t.fatal() {
+		return errors.New("transactional producer in fatal error")
+	}
+	if t.producer.TxnStatus()&(sarama.ProducerTxnFlagInTransaction|sarama.ProducerTxnFlagAbortableError) != 0 {
+		return t.producer.AbortTxn()
+	}
+	return nil
+}
+
+// ConsumeTransformProduce consume topics of group in background with read committed isolation,
+// messages returned by handler are produced with the consumed offset in one transaction (exactly-once)
+func (t *transactionalProducer) ConsumeTransformProduce(ctx context.Context, group string, topics []string, handler TransformHandler, options ...HandlerOption) error {
+	if group == "" || len(topics) == 0 {
+		return errors.New("group and topics required")
+	}
+
+	consumer, err := sarama.NewConsumerGroupFromClient(group, t.client)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	t.consumers = append(t.consumers, consumer)
+	previous := t.cancel
+	t.cancel = func() {
+		previous()
+		cancel()
+	}
+	t.mu.Unlock()
+
+	l := log.Named("kafka transactional consumer").With(
+		zap.String("name", t.name),
+		zap.String("groupId", group),
+		zap.Strings("topics", topics),
+	)
+
+	go func() {
+		for it := range consumer.Errors() {
+			l.Warn("client error", zap.Error(it))
+		}
+	}()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		h := &transformHandler{producer: t, group: group, handler: handler, options: newHandlerOptions(options...)}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				// pass
+			}
+			l.Debug("start consume")
+			if err := consumer.Consume(ctx, topics, newInstrumentedHandler(t.name, group, h)); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				if t.fatal() {
+					l.Error("stop consume, transactional producer fenced or in fatal error", zap.Error(err))
+					return
+				}
+				l.Warn("consume", zap.Error(err))
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second * 5):
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stop consumers and close producer
+func (t *transactionalProducer) Close() (err error) {
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		t.cancel()
+		consumers := t.consumers
+		t.mu.Unlock()
+
+		t.wg.Wait()
+		for _, it := range consumers {
+			_ = it.Close()
+		}
+
+		if e := t.producer.Close(); e != nil {
+			err = e
+		}
+		if e := t.client.Close(); e != nil && err == nil {
+			err = e
+		}
+	})
+	return
+}
+
+type transformHandler struct {
+	producer *transactionalProducer
+	group    string
+	handler  TransformHandler
+	options  handlerOptions
+}
+
+func (t *transformHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (t *transformHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (t *transformHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if err := t.processWithRetry(session, msg); err != nil {
+				// end session, consume from the last committed offset after rejoin
+				return errors.Wrapf(err, "topic: %v, partition: %v, offset: %v", msg.Topic, msg.Partition, msg.Offset)
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// processWithRetry transform message with retries, the message is sent to dead letter topic with the offset
+// in one transaction, or dropped if all the retries failed
+func (t *transformHandler) processWithRetry(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error {
+	ctx := session.Context()
+	l := log.Named("kafka transactional consumer")
+	fields := messageFields(t.group, msg)
+
+	var err error
+	for attempt := 1; attempt <= t.options.maxRetries+1; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(t.options.backoffOf(attempt - 1)):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		if err = t.process(ctx, msg, attempt); err == nil {
+			return nil
+		}
+
+		// neither retried nor dropped, the message is consumed again by the instance which fenced this one
+		if t.producer.fatal() {
+			return errors.Wrap(err, "transactional producer fenced or in fatal error")
+		}
+
+		l.Warn("transform message", append(fields, zap.Int("attempt", attempt), zap.Error(err))...)
+	}
+
+	// session closed, message will be redelivered
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	cause := err
+	if t.options.deadLetter == "" {
+		// transaction without records is skipped by sarama, commit offset of dropped message by session
+		l.Error("drop message", append(fields, zap.Error(cause))...)
+		session.MarkMessage(msg, "")
+		session.Commit()
+		return nil
+	}
+
+	return t.producer.Transaction(ctx, func(ctx context.Context, txn Transaction) error {
+		txn.Send(newDeadLetterMessage(t.options.deadLetter, t.group, msg, cause))
+		txn.AddOffset(msg, t.group)
+		return nil
+	})
+}
+
+func (t *transformHandler) process(ctx context.Context, msg *sarama.ConsumerMessage, attempt int) (err error) {
+	start := time.Now()
+	span, ctx := StartSpanFromMessage(ctx, msg, "kafka_transform")
+	span.SetTag("group", t.group)
+	span.SetTag("attempt", attempt)
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogKV("err", err)
+		}
+		span.Finish()
+		observeHandle(t.producer.name, t.group, msg.Topic, start, err)
+	}()
+
+	return t.producer.Transaction(ctx, func(ctx context.Context, txn Transaction) error {
+		messages, err := t.handler(ctx, &Message{ConsumerMessage: msg, Group: t.group, Attempt: attempt})
+		if err != nil {
+			return err
+		}
+		for _, it := range messages {
+			txn.Send(it)
+		}
+		txn.AddOffset(msg, t.group)
+		return nil
+	})
+}
@@ -0,0 +1,226 @@
+package kafkax
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTransactionMockBroker(t *testing.T) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(transactionMockResponses(t, broker))
+	return broker
+}
+
+func transactionMockResponses(t *testing.T, broker *sarama.MockBroker) map[string]sarama.MockResponse {
+	return map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("input", 0, broker.BrokerID()).
+			SetLeader("output", 0, broker.BrokerID()).
+			SetLeader("dead", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorTransaction, transactionalID("tx"), broker).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1}),
+		"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+			Errors: map[string][]*sarama.PartitionError{"output": {{Partition: 0}}, "dead": {{Partition: 0}}},
+		}),
+		"ProduceRequest":         sarama.NewMockProduceResponse(t).SetVersion(3),
+		"AddOffsetsToTxnRequest": sarama.NewMockWrapper(&sarama.AddOffsetsToTxnResponse{}),
+		"TxnOffsetCommitRequest": sarama.NewMockWrapper(&sarama.TxnOffsetCommitResponse{
+			Topics: map[string][]*sarama.PartitionError{"input": {{Partition: 0}}},
+		}),
+		"EndTxnRequest": sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+	}
+}
+
+func endTxnResults(broker *sarama.MockBroker) []bool {
+	var results []bool
+	for _, it := range broker.History() {
+		if req, ok := it.Request.(*sarama.EndTxnRequest); ok {
+			results = append(results, req.TransactionResult)
+		}
+	}
+	return results
+}
+
+func TestTransactionalProducer(t *testing.T) {
+	broker := newTransactionMockBroker(t)
+	defer broker.Close()
+
+	configMap["transaction"] = mqConfig{
+		Name:            "transaction",
+		Version:         "2.1.0",
+		Broker:          []string{broker.Addr()},
+		TransactionalID: "tx",
+	}
+
+	producer, err := NewTransactionalProducer("transaction")
+	require.NoError(t, err)
+	defer producer.Close()
+
+	consumed := &sarama.ConsumerMessage{Topic: "input", Partition: 0, Offset: 10}
+
+	err = producer.Transaction(context.Background(), func(ctx context.Context, txn Transaction) error {
+		txn.Send(&sarama.ProducerMessage{Topic: "output", Value: sarama.StringEncoder("hello")})
+		txn.AddOffset(consumed, "group")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = producer.Transaction(context.Background(), func(ctx context.Context, txn Transaction) error {
+		txn.Send(&sarama.ProducerMessage{Topic: "output", Value: sarama.StringEncoder("hello")})
+		return errors.New("transform failed")
+	})
+	assert.EqualError(t, err, "transform failed")
+
+	err = producer.Transaction(context.Background(), func(ctx context.Context, txn Transaction) error {
+		panic("transform panic")
+	})
+	assert.EqualError(t, err, "panic: transform panic")
+
+	// commit, and abort twice (nothing sent)
+	assert.Equal(t, []bool{true}, endTxnResults(broker))
+
+	var offsetCommitted bool
+	for _, it := range broker.History() {
+		if req, ok := it.Request.(*sarama.TxnOffsetCommitRequest); ok {
+			offsetCommitted = req.GroupID == "group" && req.Topics["input"][0].Offset == 11
+		}
+	}
+	assert.True(t, offsetCommitted)
+}
+
+func TestTransformHandler(t *testing.T) {
+	broker := newTransactionMockBroker(t)
+	defer broker.Close()
+
+	configMap["transform"] = mqConfig{
+		Name:            "transform",
+		Version:         "2.1.0",
+		Broker:          []string{broker.Addr()},
+		TransactionalID: "tx",
+	}
+
+	producer, err := NewTransactionalProducer("transform")
+	require.NoError(t, err)
+	defer producer.Close()
+
+	var attempts []int
+	h := &transformHandler{
+		producer: producer.(*transactionalProducer),
+		group:    "group",
+		handler: func(ctx context.Context, message *Message) ([]*sarama.ProducerMessage, error) {
+			if message.Offset == 1 {
+				attempts = append(attempts, message.Attempt)
+				return nil, errors.New("transform failed")
+			}
+			return []*sarama.ProducerMessage{{Topic: "output", Value: sarama.ByteEncoder(message.Value)}}, nil
+		},
+		options: newHandlerOptions(WithRetry(2, time.Millisecond, time.Millisecond)),
+	}
+
+	consume := func() *fakeSession {
+		session := &fakeSession{ctx: context.Background()}
+		claim := &fakeClaim{topic: "input", messages: make(chan *sarama.ConsumerMessage, 3)}
+		for i := 0; i < 3; i++ {
+			claim.messages <- &sarama.ConsumerMessage{Topic: "input", Offset: int64(i), Value: []byte("hello")}
+		}
+		close(claim.messages)
+		assert.NoError(t, h.ConsumeClaim(session, claim))
+		return session
+	}
+
+	committed := func(from int) []int64 {
+		var offsets []int64
+		for _, it := range broker.History()[from:] {
+			if req, ok := it.Request.(*sarama.TxnOffsetCommitRequest); ok {
+				offsets = append(offsets, req.Topics["input"][0].Offset)
+			}
+		}
+		return offsets
+	}
+
+	deadLetters := func(from int) int {
+		n := 0
+		for _, it := range broker.History()[from:] {
+			if req, ok := it.Request.(*sarama.AddPartitionsToTxnRequest); ok && len(req.TopicPartitions["dead"]) > 0 {
+				n++
+			}
+		}
+		return n
+	}
+
+	// failed message is dropped with offset committed by session after retries, instead of rejoining forever
+	session := consume()
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+	assert.Equal(t, []int64{1, 3}, committed(0))
+	assert.Equal(t, []int64{1}, session.marked)
+	assert.Equal(t, 0, deadLetters(0))
+
+	// sent to dead letter topic with offset in one transaction
+	from := len(broker.History())
+	h.options = newHandlerOptions(WithRetry(0, 0, 0), WithDeadLetter("dead"))
+	session = consume()
+	assert.Empty(t, session.marked)
+	assert.Equal(t, []int64{1, 2, 3}, committed(from))
+	assert.Equal(t, 1, deadLetters(from))
+}
+
+func TestTransformHandlerFenced(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	responses := transactionMockResponses(t, broker)
+	responses["AddPartitionsToTxnRequest"] = sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+		Errors: map[string][]*sarama.PartitionError{"output": {{Partition: 0, Err: sarama.ErrProducerFenced}}},
+	})
+	broker.SetHandlerByMap(responses)
+
+	configMap["fenced"] = mqConfig{
+		Name:            "fenced",
+		Version:         "2.1.0",
+		Broker:          []string{broker.Addr()},
+		TransactionalID: "tx",
+	}
+
+	producer, err := NewTransactionalProducer("fenced")
+	require.NoError(t, err)
+	defer producer.Close()
+
+	attempts := 0
+	h := &transformHandler{
+		producer: producer.(*transactionalProducer),
+		group:    "group",
+		handler: func(ctx context.Context, message *Message) ([]*sarama.ProducerMessage, error) {
+			attempts++
+			return []*sarama.ProducerMessage{{Topic: "output", Value: sarama.ByteEncoder(message.Value)}}, nil
+		},
+		options: newHandlerOptions(WithRetry(2, time.Millisecond, time.Millisecond)),
+	}
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{topic: "input", messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "input", Offset: 0, Value: []byte("hello")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "input", Offset: 1, Value: []byte("hello")}
+	close(claim.messages)
+
+	// fenced producer neither retries nor drops message, and stops the claim
+	assert.Error(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, session.marked)
+	assert.True(t, h.producer.fatal())
+}
+
+func TestTransactionalID(t *testing.T) {
+	assert.Equal(t, "tx", transactionalID("tx"))
+
+	t.Setenv("POD_NAME", "billing-0")
+	assert.Equal(t, "tx-billing-0", transactionalID("tx-${POD_NAME}"))
+}
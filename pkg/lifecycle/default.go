@@ -0,0 +1,32 @@
+package lifecycle
+
+import "context"
+
+var (
+	defaultLifecycle = New()
+)
+
+// Default returns the global lifecycle, which shared by xservice & builtin packages
+func Default() *Lifecycle {
+	return defaultLifecycle
+}
+
+// OnStart add start hook to global lifecycle
+func OnStart(name string, fn Hook, opts ...HookOption) {
+	defaultLifecycle.OnStart(name, fn, opts...)
+}
+
+// OnReady add ready hook to global lifecycle
+func OnReady(name string, fn Hook, opts ...HookOption) {
+	defaultLifecycle.OnReady(name, fn, opts...)
+}
+
+// OnStop add stop hook to global lifecycle
+func OnStop(name string, fn Hook, opts ...HookOption) {
+	defaultLifecycle.OnStop(name, fn, opts...)
+}
+
+// Stop run stop hooks of global lifecycle
+func Stop(ctx context.Context) *Report {
+	return defaultLifecycle.Stop(ctx)
+}
@@ -0,0 +1,238 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phase is lifecycle phase
+type Phase string
+
+const (
+	PhaseStart Phase = "start" // before server listen
+	PhaseReady Phase = "ready" // server listened & service registered
+	PhaseStop  Phase = "stop"  // shutdown
+)
+
+// hook priority, hooks run in ascending order of priority, same priority hooks run in registration order,
+// except stop phase which run in reverse registration order
+const (
+	PriorityRegistry = 10 // deregister service first, stop receiving new traffic
+	PriorityServer   = 20 // drain http & gRPC server
+	PriorityWorker   = 30 // background workers, e.g. cron & consumer
+	PriorityClient   = 40 // outgoing clients, e.g. gRPC client connections
+	PriorityDefault  = 50 // default priority
+	PriorityResource = 70 // shared resources, e.g. db & redis & kafka
+	PriorityTracing  = 80 // flush tracing & error reporter
+	PriorityLog      = 90 // flush log, last one
+)
+
+const (
+	DefaultHookTimeout = time.Second * 30 // default timeout for each hook
+)
+
+// Hook is lifecycle hook function, ctx will be canceled when hook timeout
+type Hook func(ctx context.Context) error
+
+type hook struct {
+	name     string
+	fn       Hook
+	priority int
+	timeout  time.Duration
+	seq      int
+}
+
+// HookOption for hook option
+type HookOption func(*hook)
+
+// WithPriority set hook priority, default PriorityDefault
+func WithPriority(priority int) HookOption {
+	return func(h *hook) {
+		h.priority = priority
+	}
+}
+
+// WithTimeout set hook timeout, default DefaultHookTimeout
+func WithTimeout(timeout time.Duration) HookOption {
+	return func(h *hook) {
+		h.timeout = timeout
+	}
+}
+
+// Lifecycle manage hooks of start, ready and stop phases, each phase run at most once
+type Lifecycle struct {
+	mu    sync.Mutex
+	hooks map[Phase][]*hook
+	seq   int
+	done  map[Phase]*Report
+}
+
+// New create lifecycle
+func New() *Lifecycle {
+	return &Lifecycle{
+		hooks: make(map[Phase][]*hook, 3),
+		done:  make(map[Phase]*Report, 3),
+	}
+}
+
+// OnStart add start hook, start phase abort when any hook failed
+func (t *Lifecycle) OnStart(name string, fn Hook, opts ...HookOption) {
+	t.add(PhaseStart, name, fn, opts...)
+}
+
+// OnReady add ready hook, ready phase abort when any hook failed
+func (t *Lifecycle) OnReady(name string, fn Hook, opts ...HookOption) {
+	t.add(PhaseReady, name, fn, opts...)
+}
+
+// OnStop add stop hook, all stop hooks will be executed even if some failed
+func (t *Lifecycle) OnStop(name string, fn Hook, opts ...HookOption) {
+	t.add(PhaseStop, name, fn, opts...)
+}
+
+// Start run start hooks
+func (t *Lifecycle) Start(ctx context.Context) *Report {
+	return t.Run(ctx, PhaseStart)
+}
+
+// Ready run ready hooks
+func (t *Lifecycle) Ready(ctx context.Context) *Report {
+	return t.Run(ctx, PhaseReady)
+}
+
+// Stop run stop hooks
+func (t *Lifecycle) Stop(ctx context.Context) *Report {
+	return t.Run(ctx, PhaseStop)
+}
+
+// Run run hooks of phase in priority order, each hook executed with its own deadline,
+// if phase already executed, previous report returned
+func (t *Lifecycle) Run(ctx context.Context, phase Phase) *Report {
+	t.mu.Lock()
+	if report, ok := t.done[phase]; ok {
+		t.mu.Unlock()
+		return report
+	}
+	report := &Report{Phase: phase}
+	t.done[phase] = report
+	hooks := t.sorted(phase)
+	t.mu.Unlock()
+
+	for i, h := range hooks {
+		result := t.exec(ctx, h)
+		report.Results = append(report.Results, result)
+
+		if result.Err != nil && phase != PhaseStop {
+			for _, skipped := range hooks[i+1:] {
+				report.Results = append(report.Results, HookResult{Name: skipped.name, Skipped: true})
+			}
+			break
+		}
+	}
+
+	return report
+}
+
+func (t *Lifecycle) add(phase Phase, name string, fn Hook, opts ...HookOption) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seq++
+	h := &hook{
+		name:     name,
+		fn:       fn,
+		priority: PriorityDefault,
+		timeout:  DefaultHookTimeout,
+		seq:      t.seq,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	t.hooks[phase] = append(t.hooks[phase], h)
+}
+
+// sorted returns copy of hooks sorted by priority, should be called with lock held
+func (t *Lifecycle) sorted(phase Phase) []*hook {
+	hooks := append(make([]*hook, 0, len(t.hooks[phase])), t.hooks[phase]...)
+	sort.SliceStable(hooks, func(i, j int) bool {
+		if hooks[i].priority != hooks[j].priority {
+			return hooks[i].priority < hooks[j].priority
+		}
+		if phase == PhaseStop {
+			return hooks[i].seq > hooks[j].seq
+		}
+		return hooks[i].seq < hooks[j].seq
+	})
+	return hooks
+}
+
+// exec run hook with timeout, hook which ignores ctx will be abandoned after timeout
+func (t *Lifecycle) exec(ctx context.Context, h *hook) (result HookResult) {
+	result.Name = h.name
+	start := time.Now()
+	defer func() {
+		result.Elapsed = time.Since(start)
+	}()
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if x := recover(); x != nil {
+				ch <- fmt.Errorf("panic: %v", x)
+			}
+		}()
+		ch <- h.fn(ctx)
+	}()
+
+	select {
+	case result.Err = <-ch:
+	case <-ctx.Done():
+		result.Err = ctx.Err()
+	}
+
+	return
+}
+
+// HookResult is the execution result of hook
+type HookResult struct {
+	Name    string
+	Elapsed time.Duration
+	Err     error
+	Skipped bool // skipped because of previous hook failed
+}
+
+// Report is the aggregated execution results of phase
+type Report struct {
+	Phase   Phase
+	Results []HookResult
+}
+
+// Err returns aggregated error of failed hooks, nil if all hooks succeeded
+func (t *Report) Err() error {
+	if t == nil {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(t.Results))
+	for _, r := range t.Results {
+		if r.Err != nil {
+			msgs = append(msgs, fmt.Sprint(r.Name, ": ", r.Err))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("lifecycle %s: %s", t.Phase, strings.Join(msgs, "; "))
+}
@@ -0,0 +1,74 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_stopOrder(t *testing.T) {
+	l := New()
+	order := make([]string, 0, 4)
+	add := func(name string, priority int) {
+		l.OnStop(name, func(context.Context) error {
+			order = append(order, name)
+			return nil
+		}, WithPriority(priority))
+	}
+
+	add("db", PriorityResource)
+	add("log", PriorityLog)
+	add("http", PriorityServer)
+	add("grpc", PriorityServer)
+	add("custom", PriorityDefault)
+
+	report := l.Stop(context.Background())
+	assert.NoError(t, report.Err())
+	assert.Equal(t, []string{"grpc", "http", "custom", "db", "log"}, order)
+
+	// run once
+	assert.Same(t, report, l.Stop(context.Background()))
+	assert.Len(t, order, 5)
+}
+
+func Test_stopTimeout(t *testing.T) {
+	l := New()
+	l.OnStop("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}, WithTimeout(time.Millisecond*10))
+	l.OnStop("failed", func(ctx context.Context) error {
+		return errors.New("close failed")
+	}, WithPriority(PriorityServer))
+	l.OnStop("panic", func(ctx context.Context) error {
+		panic("boom")
+	}, WithPriority(PriorityResource))
+
+	report := l.Stop(context.Background())
+	assert.Len(t, report.Results, 3)
+	assert.EqualError(t, report.Results[0].Err, "close failed")
+	assert.ErrorIs(t, report.Results[1].Err, context.DeadlineExceeded)
+	assert.Less(t, report.Results[1].Elapsed, time.Second)
+	assert.EqualError(t, report.Results[2].Err, "panic: boom")
+	assert.Error(t, report.Err())
+}
+
+func Test_startAbort(t *testing.T) {
+	l := New()
+	executed := false
+	l.OnStart("first", func(context.Context) error {
+		return errors.New("failed")
+	})
+	l.OnStart("second", func(context.Context) error {
+		executed = true
+		return nil
+	})
+
+	report := l.Start(context.Background())
+	assert.EqualError(t, report.Err(), "lifecycle start: first: failed")
+	assert.False(t, executed)
+	assert.True(t, report.Results[1].Skipped)
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,7 +13,7 @@ import (
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 
-	"github.com/xinpianchang/xservice/pkg/signalx"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 )
 
 var (
@@ -44,11 +45,16 @@ func init() {
 		"stdout": true,
 		"caller": true,
 	})
-	Config(v)
+	config(v)
 }
 
-// Config for log configuration
+// Config for log configuration, log level will be changed automatically when log.level changed
 func Config(v *viper.Viper) {
+	config(v)
+	watchLevel(v)
+}
+
+func config(v *viper.Viper) {
 	if err := v.UnmarshalKey("log", &cfg); err != nil {
 		Fatal("parse log config", zap.Error(err))
 	}
@@ -67,7 +73,9 @@ func Config(v *viper.Viper) {
 		}
 	}
 
-	if l, err := buildZapLogger(cfg); err != nil {
+	lvl := registerLevel(GlobalLevelName, parseLevel(cfg.Level))
+
+	if l, err := buildZapLogger(cfg, lvl); err != nil {
 		Fatal("config log", zap.Error(err))
 	} else {
 		zaplogger = l
@@ -91,7 +99,7 @@ func NewLogger(file string) (Logger, error) {
 		c.File = filepath.Join(filepath.Dir(cfg.File), file)
 	}
 
-	l, err := buildZapLogger(c)
+	l, err := buildZapLogger(c, registerLevel(file, parseLevel(c.Level)))
 
 	if err != nil {
 		return nil, err
@@ -100,7 +108,7 @@ func NewLogger(file string) (Logger, error) {
 	return newLogger(l), nil
 }
 
-func buildZapLogger(cfg Cfg) (*zap.Logger, error) {
+func buildZapLogger(cfg Cfg, atomicLevel zap.AtomicLevel) (*zap.Logger, error) {
 	loggerFileMapMutex.Lock()
 	defer loggerFileMapMutex.Unlock()
 
@@ -145,14 +153,6 @@ func buildZapLogger(cfg Cfg) (*zap.Logger, error) {
 		go scheduleRotate(rotateLogger)
 	}
 
-	var level zapcore.Level
-	err := level.UnmarshalText([]byte(cfg.Level))
-	if err != nil {
-		Error("parse level", zap.Error(err))
-		level = zapcore.InfoLevel
-	}
-	atomicLevel := zap.NewAtomicLevelAt(level)
-
 	writeSynced := zapcore.NewMultiWriteSyncer(ws...)
 
 	encoding := zap.NewProductionEncoderConfig()
@@ -173,13 +173,26 @@ func buildZapLogger(cfg Cfg) (*zap.Logger, error) {
 	}
 	log := zap.New(core, options...)
 	if cfg.File != "" {
-		signalx.AddShutdownHook(func(os.Signal) {
+		lifecycle.OnStop("log", func(context.Context) error {
 			_ = log.Sync()
-		})
+			return nil
+		}, lifecycle.WithPriority(lifecycle.PriorityLog))
 	}
 	return log, nil
 }
 
+func parseLevel(text string) zapcore.Level {
+	var l zapcore.Level
+	if text == "" {
+		return zapcore.InfoLevel
+	}
+	if err := l.UnmarshalText([]byte(text)); err != nil {
+		Error("parse level", zap.Error(err))
+		return zapcore.InfoLevel
+	}
+	return l
+}
+
 func scheduleRotate(log *lumberjack.Logger) {
 	for {
 		n := time.Now().Add(time.Hour * 24)
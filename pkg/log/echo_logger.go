@@ -9,6 +9,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
+	"go.uber.org/zap/zapcore"
 )
 
 // EchoLogger echo logger
@@ -51,13 +52,40 @@ func (t *EchoLogger) SetPrefix(p string) {
 	t.logger = Named(p)
 }
 
-// Level get log level
+// Level get global log level
 func (t *EchoLogger) Level() log.Lvl {
-	return log.INFO
+	l, _ := GetLevel(GlobalLevelName)
+	switch {
+	case l <= zapcore.DebugLevel:
+		return log.DEBUG
+	case l == zapcore.InfoLevel:
+		return log.INFO
+	case l == zapcore.WarnLevel:
+		return log.WARN
+	case l == zapcore.ErrorLevel:
+		return log.ERROR
+	default:
+		return log.OFF
+	}
 }
 
-// SetLvl set log level
-func (t *EchoLogger) SetLevel(v log.Lvl) {}
+// SetLevel set global log level
+func (t *EchoLogger) SetLevel(v log.Lvl) {
+	l := zapcore.InfoLevel
+	switch v {
+	case log.DEBUG:
+		l = zapcore.DebugLevel
+	case log.INFO:
+		l = zapcore.InfoLevel
+	case log.WARN:
+		l = zapcore.WarnLevel
+	case log.ERROR:
+		l = zapcore.ErrorLevel
+	case log.OFF:
+		l = zapcore.FatalLevel
+	}
+	_ = SetLevel(GlobalLevelName, l)
+}
 
 // SetHeader set header, not implemented
 func (t *EchoLogger) SetHeader(h string) {}
@@ -0,0 +1,217 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	GlobalLevelName = "global" // level name of global logger, other loggers named by file, see NewLogger
+)
+
+var (
+	levels      = make(map[string]zap.AtomicLevel, 8)
+	overridden  = make(map[string]bool, 8) // levels changed by SetLevel, kept when log.level config changed
+	levelsMutex sync.RWMutex
+
+	levelWatchStop chan struct{}
+)
+
+// registerLevel get or create atomic level by name, existing level will be reset to l
+func registerLevel(name string, l zapcore.Level) zap.AtomicLevel {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	if lvl, ok := levels[name]; ok {
+		lvl.SetLevel(l)
+		return lvl
+	}
+
+	lvl := zap.NewAtomicLevelAt(l)
+	levels[name] = lvl
+	return lvl
+}
+
+// SetLevel change log level at runtime, name is GlobalLevelName or file of NewLogger,
+// level of file logger changed here is no longer followed log.level config
+func SetLevel(name string, l zapcore.Level) error {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	lvl, ok := levels[name]
+	if !ok {
+		return errors.Errorf("logger not found, name: %v", name)
+	}
+	lvl.SetLevel(l)
+	overridden[name] = true
+	return nil
+}
+
+// GetLevel get log level by name
+func GetLevel(name string) (zapcore.Level, bool) {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	lvl, ok := levels[name]
+	if !ok {
+		return zapcore.InfoLevel, false
+	}
+	return lvl.Level(), true
+}
+
+// Levels get all log levels, name as key
+func Levels() map[string]string {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	result := make(map[string]string, len(levels))
+	for name, lvl := range levels {
+		result[name] = lvl.Level().String()
+	}
+	return result
+}
+
+// setConfigLevel change global level and file levels not overridden by SetLevel, for log.level config changed
+func setConfigLevel(l zapcore.Level) {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	for name, lvl := range levels {
+		if name != GlobalLevelName && overridden[name] {
+			continue
+		}
+		lvl.SetLevel(l)
+	}
+}
+
+type levelPayload struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// LevelHandler http handler for get (GET) or change (PUT) log levels, e.g.
+//
+//	curl -X PUT -d '{"name": "global", "level": "debug"}' http://127.0.0.1:5001/log/level
+//
+// name is optional, default global
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var payload levelPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				writeLevelResponse(w, http.StatusBadRequest, err)
+				return
+			}
+			if payload.Name == "" {
+				payload.Name = GlobalLevelName
+			}
+
+			var l zapcore.Level
+			if err := l.UnmarshalText([]byte(payload.Level)); err != nil {
+				writeLevelResponse(w, http.StatusBadRequest, err)
+				return
+			}
+
+			if err := SetLevel(payload.Name, l); err != nil {
+				writeLevelResponse(w, http.StatusNotFound, err)
+				return
+			}
+			Info("log level changed", zap.String("name", payload.Name), zap.String("level", l.String()))
+		default:
+			writeLevelResponse(w, http.StatusMethodNotAllowed, errors.Errorf("method %v not allowed", r.Method))
+			return
+		}
+
+		writeLevelResponse(w, http.StatusOK, nil)
+	})
+}
+
+func writeLevelResponse(w http.ResponseWriter, code int, err error) {
+	rsp := make(map[string]interface{}, 2)
+	if err != nil {
+		rsp["error"] = err.Error()
+	} else {
+		all := Levels()
+		names := make([]string, 0, len(all))
+		for name := range all {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]levelPayload, 0, len(names))
+		for _, name := range names {
+			list = append(list, levelPayload{Name: name, Level: all[name]})
+		}
+		rsp["levels"] = list
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(rsp)
+}
+
+// watchLevel apply log.level on config changed, by viper WatchConfig of local file or etcd remote config,
+// note that it replaces OnConfigChange callback of v
+func watchLevel(v *viper.Viper) {
+	if levelWatchStop != nil {
+		close(levelWatchStop)
+	}
+	stop := make(chan struct{})
+	levelWatchStop = stop
+
+	var mu sync.Mutex
+	last := v.GetString("log.level")
+	changed := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		current := v.GetString("log.level")
+		if current == last || current == "" {
+			return
+		}
+		last = current
+
+		var l zapcore.Level
+		if err := l.UnmarshalText([]byte(current)); err != nil {
+			Error("parse level", zap.Error(err))
+			return
+		}
+		setConfigLevel(l)
+		Info("log level changed by config", zap.String("level", l.String()))
+	}
+
+	v.OnConfigChange(func(fsnotify.Event) {
+		changed()
+	})
+
+	// remote config, WatchRemoteConfig blocks until changed
+	if v.ConfigFileUsed() != "" || viper.RemoteConfig == nil {
+		return
+	}
+	go func() {
+		for {
+			err := v.WatchRemoteConfig()
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err != nil {
+				Warn("watch remote config", zap.Error(err))
+				time.Sleep(time.Second * 5)
+				continue
+			}
+			changed()
+		}
+	}()
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_setLevel(t *testing.T) {
+	assert.NoError(t, SetLevel(GlobalLevelName, zapcore.DebugLevel))
+	assert.True(t, Get().Core().Enabled(zapcore.DebugLevel))
+
+	assert.NoError(t, SetLevel(GlobalLevelName, zapcore.WarnLevel))
+	assert.False(t, Get().Core().Enabled(zapcore.InfoLevel))
+
+	assert.Error(t, SetLevel("not-exists.log", zapcore.InfoLevel))
+}
+
+func Test_levelHandler(t *testing.T) {
+	handler := LevelHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level": "error"}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"name":"global","level":"error"}`)
+
+	l, ok := GetLevel(GlobalLevelName)
+	assert.True(t, ok)
+	assert.Equal(t, zapcore.ErrorLevel, l)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level": "invalid"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/level", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func Test_watchLevel(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("log:\n  level: info\n"), 0600))
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	require.NoError(t, v.ReadInConfig())
+	v.WatchConfig()
+	Config(v)
+
+	_, err := NewLogger("followed.log")
+	require.NoError(t, err)
+	_, err = NewLogger("overridden.log")
+	require.NoError(t, err)
+	require.NoError(t, SetLevel("overridden.log", zapcore.ErrorLevel))
+
+	require.NoError(t, os.WriteFile(file, []byte("log:\n  level: warn\n"), 0600))
+	assert.Eventually(t, func() bool {
+		l, _ := GetLevel(GlobalLevelName)
+		return l == zapcore.WarnLevel
+	}, time.Second*5, time.Millisecond*10)
+
+	l, _ := GetLevel("followed.log")
+	assert.Equal(t, zapcore.WarnLevel, l)
+	l, _ = GetLevel("overridden.log")
+	assert.Equal(t, zapcore.ErrorLevel, l)
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// EchoKeyFunc extract rate limit key from echo context
+type EchoKeyFunc func(c echo.Context) (string, error)
+
+// EchoConfig echo rate limit middleware config
+type EchoConfig struct {
+	// Skipper defines a function to skip middleware
+	Skipper middleware.Skipper
+
+	// Limiter rate limiter, required
+	Limiter Limiter
+
+	// Limit rate limit rule, required
+	Limit Limit
+
+	// KeyFunc extract key of request, default EchoKeyByIP
+	KeyFunc EchoKeyFunc
+
+	// Name key namespace, default route path, that is limited per route.
+	// set the same name for routes to share limit
+	Name string
+}
+
+// EchoKeyByIP key by real ip of request
+func EchoKeyByIP(c echo.Context) (string, error) {
+	return c.RealIP(), nil
+}
+
+// EchoKeyByJWTSubject key by subject of jwt token which parsed by echo jwt middleware (context key "user"),
+// fallback to real ip if token not exists
+func EchoKeyByJWTSubject(c echo.Context) (string, error) {
+	if token, ok := c.Get(middleware.DefaultJWTConfig.ContextKey).(*jwt.Token); ok {
+		switch claims := token.Claims.(type) {
+		case jwt.MapClaims:
+			if sub, ok := claims["sub"].(string); ok && sub != "" {
+				return fmt.Sprint("sub:", sub), nil
+			}
+		case *jwt.StandardClaims:
+			if claims.Subject != "" {
+				return fmt.Sprint("sub:", claims.Subject), nil
+			}
+		}
+	}
+	return EchoKeyByIP(c)
+}
+
+// EchoMiddleware rate limit middleware keyed by keyFunc, responds 429 with Retry-After header when exceeded
+func EchoMiddleware(limiter Limiter, limit Limit, keyFunc EchoKeyFunc) echo.MiddlewareFunc {
+	return EchoMiddlewareWithConfig(EchoConfig{
+		Limiter: limiter,
+		Limit:   limit,
+		KeyFunc: keyFunc,
+	})
+}
+
+// EchoMiddlewareWithConfig rate limit middleware with config, requests are allowed if limiter failed
+func EchoMiddlewareWithConfig(config EchoConfig) echo.MiddlewareFunc {
+	if config.Limiter == nil {
+		panic("ratelimit: limiter required")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = EchoKeyByIP
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			key, err := config.KeyFunc(c)
+			if err != nil {
+				return err
+			}
+
+			name := config.Name
+			if name == "" {
+				name = c.Request().Method + ":" + c.Path()
+			}
+
+			ctx := c.Request().Context()
+			result, err := config.Limiter.Allow(ctx, fmt.Sprint(name, ":", key), config.Limit)
+			if err != nil {
+				log.For(ctx).Warn("ratelimit", zap.Error(err))
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+			header.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+
+			if !result.Allowed {
+				header.Set(HeaderRetryAfter, retryAfterSeconds(result.RetryAfter))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds()))))
+}
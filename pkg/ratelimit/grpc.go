@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/xinpianchang/xservice/pkg/grpcx"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+// GrpcKeyFunc extract rate limit key from grpc context
+type GrpcKeyFunc func(ctx context.Context, fullMethod string) (string, error)
+
+// GrpcConfig grpc rate limit interceptor config
+type GrpcConfig struct {
+	// Skipper skip rate limit of method
+	Skipper func(ctx context.Context, fullMethod string) bool
+
+	// Limiter rate limiter, required
+	Limiter Limiter
+
+	// Limit rate limit rule, required
+	Limit Limit
+
+	// KeyFunc extract key of request, default GrpcKeyByIP
+	KeyFunc GrpcKeyFunc
+
+	// Name key namespace, default full method name, that is limited per method.
+	// set the same name for methods to share limit
+	Name string
+}
+
+// GrpcKeyByIP key by peer ip, real ip of metadata (x-forwarded-for, x-real-ip) is only trusted
+// if peer is a proxy of loopback or private network, e.g. grpc gateway or load balancer
+func GrpcKeyByIP(ctx context.Context, _ string) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "", nil
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		if realIP := grpcx.GetRealIP(ctx); realIP != "" {
+			return realIP, nil
+		}
+	}
+	return host, nil
+}
+
+// GrpcKeyByJWTSubject key by subject of bearer jwt token in authorization metadata, which verified with keyFunc,
+// fallback to ip if token not exists
+func GrpcKeyByJWTSubject(keyFunc jwt.Keyfunc) GrpcKeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		auth := grpcx.GetMetaDataFirst(md, "authorization")
+		if !strings.HasPrefix(strings.ToLower(auth), "bearer ") {
+			return GrpcKeyByIP(ctx, fullMethod)
+		}
+
+		var claims jwt.StandardClaims
+		if _, err := jwt.ParseWithClaims(strings.TrimSpace(auth[len("bearer "):]), &claims, keyFunc); err != nil {
+			return "", status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if claims.Subject == "" {
+			return GrpcKeyByIP(ctx, fullMethod)
+		}
+		return fmt.Sprint("sub:", claims.Subject), nil
+	}
+}
+
+// UnaryServerInterceptor rate limit unary interceptor, returns RESOURCE_EXHAUSTED with retry-after header when exceeded
+func UnaryServerInterceptor(config GrpcConfig) grpc.UnaryServerInterceptor {
+	config = config.withDefaults()
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := config.allow(ctx, info.FullMethod, func(md metadata.MD) error {
+			return grpc.SetHeader(ctx, md)
+		}); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rate limit stream interceptor, returns RESOURCE_EXHAUSTED with retry-after header when exceeded
+func StreamServerInterceptor(config GrpcConfig) grpc.StreamServerInterceptor {
+	config = config.withDefaults()
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := config.allow(ss.Context(), info.FullMethod, ss.SetHeader); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (t GrpcConfig) withDefaults() GrpcConfig {
+	if t.Limiter == nil {
+		panic("ratelimit: limiter required")
+	}
+	if t.KeyFunc == nil {
+		t.KeyFunc = GrpcKeyByIP
+	}
+	return t
+}
+
+func (t GrpcConfig) allow(ctx context.Context, fullMethod string, setHeader func(metadata.MD) error) error {
+	if t.Skipper != nil && t.Skipper(ctx, fullMethod) {
+		return nil
+	}
+
+	key, err := t.KeyFunc(ctx, fullMethod)
+	if err != nil {
+		return err
+	}
+
+	name := t.Name
+	if name == "" {
+		name = fullMethod
+	}
+
+	result, err := t.Limiter.Allow(ctx, fmt.Sprint(name, ":", key), t.Limit)
+	if err != nil {
+		log.For(ctx).Warn("ratelimit", zap.Error(err))
+		return nil
+	}
+
+	if !result.Allowed {
+		_ = setHeader(metadata.Pairs(strings.ToLower(HeaderRetryAfter), retryAfterSeconds(result.RetryAfter)))
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %v", result.RetryAfter)
+	}
+
+	return nil
+}
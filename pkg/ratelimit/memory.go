@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	memoryCleanupInterval = time.Minute
+)
+
+type memoryLimiter struct {
+	algorithm Algorithm
+
+	mu          sync.Mutex
+	windows     map[string]*memoryWindow
+	buckets     map[string]*memoryBucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type memoryWindow struct {
+	hits   []time.Time
+	period time.Duration
+}
+
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+	full   time.Duration // duration to refill from empty to full
+}
+
+// NewMemory create in-memory limiter, limits are per process
+func NewMemory(algorithm Algorithm) Limiter {
+	return &memoryLimiter{
+		algorithm:   algorithm,
+		windows:     make(map[string]*memoryWindow),
+		buckets:     make(map[string]*memoryBucket),
+		lastCleanup: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Allow check whether one request of key allowed under limit
+func (t *memoryLimiter) Allow(_ context.Context, key string, limit Limit) (*Result, error) {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return nil, errors.New("invalid limit")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.cleanup(now)
+
+	if t.algorithm == TokenBucket {
+		return t.tokenBucket(now, key, limit), nil
+	}
+	return t.slidingWindow(now, key, limit), nil
+}
+
+func (t *memoryLimiter) slidingWindow(now time.Time, key string, limit Limit) *Result {
+	w, ok := t.windows[key]
+	if !ok {
+		w = &memoryWindow{}
+		t.windows[key] = w
+	}
+	w.period = limit.Period
+
+	start := now.Add(-limit.Period)
+	i := 0
+	for i < len(w.hits) && !w.hits[i].After(start) {
+		i++
+	}
+	w.hits = w.hits[i:]
+
+	if len(w.hits) < limit.Rate {
+		w.hits = append(w.hits, now)
+		return &Result{Allowed: true, Limit: limit.Rate, Remaining: limit.Rate - len(w.hits)}
+	}
+
+	return &Result{Limit: limit.Rate, RetryAfter: w.hits[0].Add(limit.Period).Sub(now)}
+}
+
+func (t *memoryLimiter) tokenBucket(now time.Time, key string, limit Limit) *Result {
+	burst := float64(limit.burst())
+	rate := float64(limit.Rate) / float64(limit.Period)
+
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: burst, ts: now}
+		t.buckets[key] = b
+	}
+	b.full = time.Duration(burst / rate)
+
+	if elapsed := now.Sub(b.ts); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+float64(elapsed)*rate)
+	}
+	b.ts = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return &Result{Allowed: true, Limit: int(burst), Remaining: int(b.tokens)}
+	}
+
+	return &Result{Limit: int(burst), RetryAfter: time.Duration(math.Ceil((1 - b.tokens) / rate))}
+}
+
+// cleanup remove idle keys periodically
+func (t *memoryLimiter) cleanup(now time.Time) {
+	if now.Sub(t.lastCleanup) < memoryCleanupInterval {
+		return
+	}
+	t.lastCleanup = now
+
+	for key, w := range t.windows {
+		if len(w.hits) == 0 || now.Sub(w.hits[len(w.hits)-1]) > w.period {
+			delete(t.windows, key)
+		}
+	}
+	for key, b := range t.buckets {
+		if now.Sub(b.ts) > b.full {
+			delete(t.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package ratelimit distributed rate limiter backed by redis (sliding window & token bucket),
+// with in-memory fallback, and middlewares for echo routes and grpc methods.
+//
+// grpc interceptors could be added via xservice.WithGrpcServerOptions, e.g.
+//
+//	grpc.ChainUnaryInterceptor(ratelimit.UnaryServerInterceptor(ratelimit.GrpcConfig{...}))
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Algorithm rate limit algorithm
+type Algorithm int
+
+const (
+	// SlidingWindow allow at most Rate requests in any Period
+	SlidingWindow Algorithm = iota
+	// TokenBucket refill Rate tokens per Period, and allow bursts up to Burst
+	TokenBucket
+)
+
+// Limit rate limit rule
+type Limit struct {
+	Rate   int           // requests per period
+	Period time.Duration // period of rate
+	Burst  int           // token bucket capacity, default Rate
+}
+
+// PerSecond limit n requests per second
+func PerSecond(n int) Limit {
+	return Limit{Rate: n, Period: time.Second}
+}
+
+// PerMinute limit n requests per minute
+func PerMinute(n int) Limit {
+	return Limit{Rate: n, Period: time.Minute}
+}
+
+func (t Limit) burst() int {
+	if t.Burst > 0 {
+		return t.Burst
+	}
+	return t.Rate
+}
+
+// Result rate limit result
+type Result struct {
+	Allowed    bool          // whether request allowed
+	Limit      int           // max requests (or burst) of limit
+	Remaining  int           // remaining requests
+	RetryAfter time.Duration // duration to wait for next allowed request if not allowed
+}
+
+// Limiter rate limiter
+type Limiter interface {
+	// Allow check whether one request of key allowed under limit
+	Allow(ctx context.Context, key string, limit Limit) (*Result, error)
+}
@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newClient(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return s, client
+}
+
+func TestMemorySlidingWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewMemory(SlidingWindow).(*memoryLimiter)
+	limiter.now = func() time.Time { return now }
+	limiter.lastCleanup = now
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		r, err := limiter.Allow(ctx, "a", PerSecond(3))
+		require.NoError(t, err)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, 2-i, r.Remaining)
+		now = now.Add(time.Millisecond * 100)
+	}
+
+	r, err := limiter.Allow(ctx, "a", PerSecond(3))
+	require.NoError(t, err)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Millisecond*700, r.RetryAfter)
+
+	r, _ = limiter.Allow(ctx, "b", PerSecond(3))
+	assert.True(t, r.Allowed)
+
+	now = now.Add(time.Millisecond * 700)
+	r, _ = limiter.Allow(ctx, "a", PerSecond(3))
+	assert.True(t, r.Allowed)
+
+	_, err = limiter.Allow(ctx, "a", Limit{})
+	assert.Error(t, err)
+}
+
+func TestMemoryTokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewMemory(TokenBucket).(*memoryLimiter)
+	limiter.now = func() time.Time { return now }
+	limiter.lastCleanup = now
+
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Period: time.Second, Burst: 2}
+	for i := 0; i < 2; i++ {
+		r, err := limiter.Allow(ctx, "a", limit)
+		require.NoError(t, err)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, 2, r.Limit)
+	}
+
+	r, _ := limiter.Allow(ctx, "a", limit)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Second, r.RetryAfter)
+
+	now = now.Add(time.Millisecond * 500)
+	r, _ = limiter.Allow(ctx, "a", limit)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Millisecond*500, r.RetryAfter)
+
+	now = now.Add(time.Millisecond * 500)
+	r, _ = limiter.Allow(ctx, "a", limit)
+	assert.True(t, r.Allowed)
+
+	// idle keys removed
+	now = now.Add(time.Hour)
+	_, _ = limiter.Allow(ctx, "b", limit)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestRedis(t *testing.T) {
+	_, client := newClient(t)
+	ctx := context.Background()
+
+	for _, algorithm := range []Algorithm{SlidingWindow, TokenBucket} {
+		limiter := NewRedis(client, algorithm)
+		for i := 0; i < 3; i++ {
+			r, err := limiter.Allow(ctx, "redis", PerMinute(3))
+			require.NoError(t, err)
+			assert.True(t, r.Allowed, "algorithm %v", algorithm)
+			assert.Equal(t, 3, r.Limit)
+			assert.Equal(t, 2-i, r.Remaining)
+		}
+
+		r, err := limiter.Allow(ctx, "redis", PerMinute(3))
+		require.NoError(t, err)
+		assert.False(t, r.Allowed, "algorithm %v", algorithm)
+		assert.True(t, r.RetryAfter > 0 && r.RetryAfter <= time.Minute, "retry after %v", r.RetryAfter)
+
+		require.NoError(t, client.FlushAll(ctx).Err())
+	}
+}
+
+func TestRedisFallback(t *testing.T) {
+	s, client := newClient(t)
+	limiter := NewRedis(client, SlidingWindow)
+	s.Close()
+
+	ctx := context.Background()
+	r, err := limiter.Allow(ctx, "fallback", PerMinute(1))
+	require.NoError(t, err)
+	assert.True(t, r.Allowed)
+
+	r, err = limiter.Allow(ctx, "fallback", PerMinute(1))
+	require.NoError(t, err)
+	assert.False(t, r.Allowed)
+}
+
+func TestEchoMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(EchoMiddleware(NewMemory(SlidingWindow), PerMinute(2), EchoKeyByIP))
+	e.GET("/hello", func(c echo.Context) error {
+		return c.String(http.StatusOK, "hello")
+	})
+
+	do := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		req.Header.Set(echo.HeaderXRealIP, ip)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("10.0.0.1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.1").Code)
+
+	rec = do("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "60", rec.Header().Get(HeaderRetryAfter))
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.2").Code)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(GrpcConfig{
+		Limiter: NewMemory(TokenBucket),
+		Limit:   PerMinute(1),
+		KeyFunc: func(ctx context.Context, fullMethod string) (string, error) {
+			return "key", nil
+		},
+	})
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.Greeter/SayHello"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	resp, err := interceptor(context.Background(), nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = interceptor(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// limited per method
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/hello.Greeter/SayBye"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestGrpcKeyByIP(t *testing.T) {
+	key := func(peerIP string, md metadata.MD) string {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(peerIP), Port: 1234}})
+		ctx = metadata.NewIncomingContext(ctx, md)
+		k, err := GrpcKeyByIP(ctx, "")
+		require.NoError(t, err)
+		return k
+	}
+
+	assert.Equal(t, "8.8.8.8", key("8.8.8.8", nil))
+
+	// spoofed by direct client
+	assert.Equal(t, "8.8.8.8", key("8.8.8.8", metadata.Pairs("x-forwarded-for", "1.1.1.1")))
+	assert.Equal(t, "8.8.8.8", key("8.8.8.8", metadata.Pairs("x-real-ip", "1.1.1.1")))
+
+	// trusted proxy
+	assert.Equal(t, "1.1.1.1", key("127.0.0.1", metadata.Pairs("x-forwarded-for", "1.1.1.1, 10.0.0.1")))
+	assert.Equal(t, "1.1.1.1", key("10.0.0.2", metadata.Pairs("x-real-ip", "1.1.1.1")))
+	assert.Equal(t, "10.0.0.2", key("10.0.0.2", nil))
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+	"github.com/xinpianchang/xservice/pkg/redisx"
+)
+
+// slidingWindowScript sorted set of request timestamps (microseconds) in window
+//
+// KEYS[1] key, ARGV[1] now, ARGV[2] window, ARGV[3] limit, ARGV[4] member
+// returns {allowed, remaining, retry after}
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, math.ceil(window / 1000))
+	return {1, limit - count - 1, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+// tokenBucketScript hash of tokens & last refill timestamp (microseconds)
+//
+// KEYS[1] key, ARGV[1] now, ARGV[2] tokens per microsecond, ARGV[3] burst
+// returns {allowed, remaining, retry after}
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+
+local data = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HMSET', key, 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', key, math.ceil(burst / rate / 1000) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+type redisLimiter struct {
+	client    redis.UniversalClient
+	algorithm Algorithm
+	fallback  Limiter
+}
+
+// NewRedis create redis limiter, keys are prefixed by redisx.Key,
+// falls back to in-memory limiter (per process) when redis unavailable
+func NewRedis(client redis.UniversalClient, algorithm Algorithm) Limiter {
+	return &redisLimiter{
+		client:    client,
+		algorithm: algorithm,
+		fallback:  NewMemory(algorithm),
+	}
+}
+
+// Allow check whether one request of key allowed under limit
+func (t *redisLimiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return nil, errors.New("invalid limit")
+	}
+
+	result, err := t.allow(ctx, key, limit)
+	if err != nil {
+		log.For(ctx).Warn("ratelimit redis, fallback to memory", zap.String("key", key), zap.Error(err))
+		return t.fallback.Allow(ctx, key, limit)
+	}
+	return result, nil
+}
+
+func (t *redisLimiter) allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	k := redisx.Key(t.client, "ratelimit", key)
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+
+	var (
+		values []int64
+		err    error
+		max    = limit.Rate
+	)
+
+	if t.algorithm == TokenBucket {
+		max = limit.burst()
+		rate := float64(limit.Rate) / float64(limit.Period/time.Microsecond)
+		values, err = tokenBucketScript.Run(ctx, t.client, []string{k}, now, rate, max).Int64Slice()
+	} else {
+		member := fmt.Sprint(now, "-", rand.Int63())
+		values, err = slidingWindowScript.Run(ctx, t.client, []string{k}, now, int64(limit.Period/time.Microsecond), max, member).Int64Slice()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, errors.Errorf("unexpected script result: %v", values)
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Limit:      max,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+	}, nil
+}
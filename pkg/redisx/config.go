@@ -5,36 +5,49 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/bsm/redislock"
 	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
+	"github.com/xinpianchang/xservice/pkg/health"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 	"github.com/xinpianchang/xservice/pkg/log"
-	"github.com/xinpianchang/xservice/pkg/signalx"
 )
 
 var (
-	clients map[string]*redis.Client
+	clients map[string]redis.UniversalClient
 	Locker  *redislock.Client
-	cfgMap  map[*redis.Client]*redisConfig
+	cfgMap  map[redis.UniversalClient]*redisConfig
+)
+
+const (
+	ModeSingle   = "single"   // single node, default
+	ModeSentinel = "sentinel" // sentinel failover, requires masterName
+	ModeCluster  = "cluster"  // redis cluster
 )
 
 type redisConfig struct {
-	Name         string `yaml:"name"`
-	Addr         string `yaml:"addr"`
-	Password     string `yaml:"password"`
-	ReadTimeout  int    `yaml:"readTimeout"`
-	DB           int    `yaml:"db"`
-	PoolSize     int    `yaml:"poolSize"`
-	MaxRetries   int    `yaml:"maxRetries"`
-	MinIdleConns int    `yaml:"minIdleConns"`
-	MaxConnAge   int    `yaml:"maxConnAge"`
-	Prefix       string `yaml:"prefix"`
+	Name             string   `yaml:"name"`
+	Mode             string   `yaml:"mode"`       // single (default), sentinel, cluster
+	Addr             string   `yaml:"addr"`       // address of single node
+	Addrs            []string `yaml:"addrs"`      // sentinel or cluster seed addresses, default [addr]
+	MasterName       string   `yaml:"masterName"` // sentinel master name
+	Username         string   `yaml:"username"`
+	Password         string   `yaml:"password"`
+	SentinelPassword string   `yaml:"sentinelPassword"`
+	ReadOnly         bool     `yaml:"readOnly"` // cluster, route readonly commands to replicas
+	ReadTimeout      int      `yaml:"readTimeout"`
+	DB               int      `yaml:"db"`
+	PoolSize         int      `yaml:"poolSize"`
+	MaxRetries       int      `yaml:"maxRetries"`
+	MinIdleConns     int      `yaml:"minIdleConns"`
+	MaxConnAge       int      `yaml:"maxConnAge"`
+	Prefix           string   `yaml:"prefix"`
 }
 
 func Config(v *viper.Viper) {
@@ -44,8 +57,8 @@ func Config(v *viper.Viper) {
 		log.Fatal("read redis config", zap.Error(err))
 	}
 
-	clients = make(map[string]*redis.Client, len(cfg))
-	cfgMap = make(map[*redis.Client]*redisConfig, len(cfg))
+	clients = make(map[string]redis.UniversalClient, len(cfg))
+	cfgMap = make(map[redis.UniversalClient]*redisConfig, len(cfg))
 	for _, c := range cfg {
 		if c.MinIdleConns <= 0 {
 			c.MinIdleConns = 0
@@ -70,16 +83,10 @@ func Config(v *viper.Viper) {
 			c.Prefix = prefix
 		}
 
-		client := redis.NewClient(&redis.Options{
-			Addr:            c.Addr,
-			Password:        c.Password,
-			DB:              c.DB,
-			ReadTimeout:     time.Second * time.Duration(c.ReadTimeout),
-			MaxRetries:      c.MaxRetries,
-			MinIdleConns:    c.MinIdleConns,
-			ConnMaxLifetime: time.Second * time.Duration(c.MaxConnAge),
-			PoolSize:        c.PoolSize,
-		})
+		client, err := newClient(c)
+		if err != nil {
+			log.Fatal("redis config", zap.String("name", c.Name), zap.Error(err))
+		}
 		r := client.Ping(context.TODO())
 		if err := r.Err(); err != nil {
 			log.Fatal("ping", zap.String("name", c.Name), zap.Error(err))
@@ -89,9 +96,15 @@ func Config(v *viper.Viper) {
 		// 	zap.String("rsp", r.Val()), zap.String("addr", c.Addr), zap.Int("db", c.DB))
 
 		client.AddHook(&redisTracing{})
+		client.AddHook(&redisMetrics{name: c.Name})
 
 		clients[c.Name] = client
 		cfgMap[client] = c
+		poolStats.add(c.Name, client)
+
+		health.Register(fmt.Sprint("redis:", c.Name), func(ctx context.Context) error {
+			return client.Ping(ctx).Err()
+		})
 
 		// as main redis
 		if c.Name == "redis" && Locker == nil {
@@ -99,22 +112,65 @@ func Config(v *viper.Viper) {
 		}
 	}
 
-	signalx.AddShutdownHook(func(os.Signal) {
-		for _, c := range clients {
+	lifecycle.OnStop("redis", func(context.Context) error {
+		for name, c := range clients {
+			poolStats.remove(name)
 			_ = c.Close()
 		}
-	})
+		return nil
+	}, lifecycle.WithPriority(lifecycle.PriorityResource))
+}
+
+func newClient(c *redisConfig) (redis.UniversalClient, error) {
+	options := &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		Username:         c.Username,
+		Password:         c.Password,
+		SentinelPassword: c.SentinelPassword,
+		DB:               c.DB,
+		ReadOnly:         c.ReadOnly,
+		ReadTimeout:      time.Second * time.Duration(c.ReadTimeout),
+		MaxRetries:       c.MaxRetries,
+		MinIdleConns:     c.MinIdleConns,
+		ConnMaxLifetime:  time.Second * time.Duration(c.MaxConnAge),
+		PoolSize:         c.PoolSize,
+	}
+	if len(options.Addrs) == 0 && c.Addr != "" {
+		options.Addrs = []string{c.Addr}
+	}
+
+	switch c.Mode {
+	case "", ModeSingle:
+		if len(options.Addrs) > 1 {
+			return nil, errors.New("single mode requires exactly one address")
+		}
+		return redis.NewClient(options.Simple()), nil
+	case ModeSentinel:
+		if c.MasterName == "" {
+			return nil, errors.New("sentinel mode requires masterName")
+		}
+		return redis.NewFailoverClient(options.Failover()), nil
+	case ModeCluster:
+		if c.DB != 0 {
+			return nil, errors.New("cluster mode only supports db 0")
+		}
+		return redis.NewClusterClient(options.Cluster()), nil
+	default:
+		return nil, errors.Errorf("unsupported mode: %v", c.Mode)
+	}
 }
 
-func GetClient(name string) *redis.Client {
+// GetClient get redis client by name, which is single, sentinel failover or cluster client according to mode
+func GetClient(name string) redis.UniversalClient {
 	return clients[name]
 }
 
-func NewLocker(client *redis.Client) *redislock.Client {
+func NewLocker(client redis.UniversalClient) *redislock.Client {
 	return redislock.New(client)
 }
 
-func Key(client *redis.Client, keys ...string) string {
+func Key(client redis.UniversalClient, keys ...string) string {
 	if c, ok := cfgMap[client]; ok {
 		keys = append(append(make([]string, 0, len(keys)+1), c.Prefix), keys...)
 	}
@@ -122,7 +178,7 @@ func Key(client *redis.Client, keys ...string) string {
 }
 
 type ClientWrapper struct {
-	*redis.Client
+	redis.UniversalClient
 }
 
 func Get(name string) *ClientWrapper {
@@ -130,10 +186,10 @@ func Get(name string) *ClientWrapper {
 }
 
 func (t *ClientWrapper) Key(keys ...string) string {
-	return Key(t.Client, keys...)
+	return Key(t.UniversalClient, keys...)
 }
 
 func (t *ClientWrapper) Obtain(ctx context.Context, key string, ttl time.Duration, opt *redislock.Options) (*redislock.Lock, error) {
-	locker := NewLocker(t.Client)
+	locker := NewLocker(t.UniversalClient)
 	return locker.Obtain(ctx, key, ttl, opt)
 }
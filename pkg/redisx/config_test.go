@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/go-redis/redis/v9"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +43,26 @@ func Test_wrapper(t *testing.T) {
 	assert.NoError(t, err)
 	t.Log("result:", ret)
 }
+
+func Test_newClient(t *testing.T) {
+	client, err := newClient(&redisConfig{Addr: "127.0.0.1:6379"})
+	assert.NoError(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+
+	client, err = newClient(&redisConfig{Mode: ModeSentinel, Addrs: []string{"127.0.0.1:26379"}, MasterName: "master"})
+	assert.NoError(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+
+	client, err = newClient(&redisConfig{Mode: ModeCluster, Addrs: []string{"127.0.0.1:7000", "127.0.0.1:7001"}})
+	assert.NoError(t, err)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+
+	_, err = newClient(&redisConfig{Mode: ModeSentinel, Addrs: []string{"127.0.0.1:26379"}})
+	assert.Error(t, err)
+
+	_, err = newClient(&redisConfig{Mode: ModeCluster, Addrs: []string{"127.0.0.1:7000"}, DB: 1})
+	assert.Error(t, err)
+
+	_, err = newClient(&redisConfig{Mode: "unknown"})
+	assert.Error(t, err)
+}
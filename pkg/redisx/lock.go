@@ -0,0 +1,173 @@
+package redisx
+
+import (
+	"context"
+	"time"
+
+	"github.com/bsm/redislock"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	lockReleaseTimeout = time.Second * 5
+	defaultLockName    = "default"
+)
+
+var (
+	// ErrLockNotObtained lock is held by others and not obtained after retries
+	ErrLockNotObtained = redislock.ErrNotObtained
+
+	// ErrLockLost lock expired or taken by others while fn running
+	ErrLockLost = errors.New("redisx: lock lost")
+
+	// ErrLockRefresh refresh interval of lock is not positive
+	ErrLockRefresh = errors.New("redisx: lock refresh interval must be positive")
+)
+
+type lockOptions struct {
+	retry   redislock.RetryStrategy
+	refresh time.Duration
+	name    string
+}
+
+// LockOption lock option
+type LockOption func(*lockOptions)
+
+// WithLockRetry retry strategy of obtaining lock, default exponential backoff from 16ms to 512ms,
+// retry is bounded by deadline of context, or ttl if context has no deadline
+func WithLockRetry(retry redislock.RetryStrategy) LockOption {
+	return func(o *lockOptions) {
+		o.retry = retry
+	}
+}
+
+// WithLockRefresh refresh interval of lock, default ttl/3, must be positive
+func WithLockRefresh(interval time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.refresh = interval
+	}
+}
+
+// WithLockName metrics label of lock, default "default", key is not used as it may be dynamic
+func WithLockName(name string) LockOption {
+	return func(o *lockOptions) {
+		o.name = name
+	}
+}
+
+// WithLock run fn while holding lock of key, using the main redis (named "redis"), see ClientWrapper.WithLock
+func WithLock(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) error, opts ...LockOption) error {
+	if Locker == nil {
+		return errors.New("redisx: main redis not configured")
+	}
+	return withLock(ctx, Locker, key, ttl, fn, opts...)
+}
+
+// WithLock obtain lock of key with retry, and refresh it in background while fn running,
+// the context of fn is canceled if lock lost, the lock is always released after fn returned.
+//
+// returns ErrLockRefresh if refresh interval not positive (e.g. ttl less than 3ns without WithLockRefresh),
+// ErrLockNotObtained if lock not obtained, ErrLockLost if lock lost while running, otherwise error of fn
+func (t *ClientWrapper) WithLock(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) error, opts ...LockOption) error {
+	return withLock(ctx, NewLocker(t.UniversalClient), key, ttl, fn, opts...)
+}
+
+func withLock(ctx context.Context, locker *redislock.Client, key string, ttl time.Duration, fn func(ctx context.Context) error, opts ...LockOption) error {
+	o := lockOptions{
+		retry:   redislock.ExponentialBackoff(time.Millisecond*16, time.Millisecond*512),
+		refresh: ttl / 3,
+		name:    defaultLockName,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.refresh <= 0 {
+		return ErrLockRefresh
+	}
+
+	lock, err := locker.Obtain(ctx, key, ttl, &redislock.Options{RetryStrategy: o.retry})
+	if err != nil {
+		if err == redislock.ErrNotObtained {
+			lockContentions.WithLabelValues(o.name).Inc()
+		}
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	lost := make(chan struct{})
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		keepLock(fnCtx, lock, ttl, o, done, func() {
+			lockLosts.WithLabelValues(o.name).Inc()
+			close(lost)
+			cancel()
+		})
+	}()
+
+	defer func() {
+		close(done)
+		<-stopped
+		cancel()
+
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), lockReleaseTimeout)
+		defer releaseCancel()
+		if err := lock.Release(releaseCtx); err != nil && err != redislock.ErrLockNotHeld {
+			log.For(ctx).Warn("release lock", zap.String("key", key), zap.Error(err))
+		}
+	}()
+
+	err = fn(fnCtx)
+
+	select {
+	case <-lost:
+		return ErrLockLost
+	default:
+		return err
+	}
+}
+
+// keepLock refresh lock periodically until done, onLost is called if lock lost
+func keepLock(ctx context.Context, lock *redislock.Lock, ttl time.Duration, o lockOptions, done <-chan struct{}, onLost func()) {
+	ticker := time.NewTicker(o.refresh)
+	defer ticker.Stop()
+
+	refreshed := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := lock.Refresh(ctx, ttl, nil)
+		if err == nil {
+			refreshed = time.Now()
+			continue
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if err == redislock.ErrNotObtained || time.Since(refreshed) >= ttl {
+			log.For(ctx).Warn("lock lost", zap.String("key", lock.Key()), zap.Error(err))
+			onLost()
+			return
+		}
+
+		// transient error, retry on next tick while lock not expired
+		log.For(ctx).Warn("refresh lock", zap.String("key", lock.Key()), zap.Error(err))
+	}
+}
@@ -0,0 +1,95 @@
+package redisx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bsm/redislock"
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLockClient(t *testing.T) (*miniredis.Miniredis, *ClientWrapper) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return s, &ClientWrapper{client}
+}
+
+func TestWithLock(t *testing.T) {
+	s, client := newLockClient(t)
+	ctx := context.Background()
+
+	errFn := errors.New("fn")
+	err := client.WithLock(ctx, "lock", time.Second, func(ctx context.Context) error {
+		assert.True(t, s.Exists("lock"))
+		return errFn
+	})
+	assert.Equal(t, errFn, err)
+	assert.False(t, s.Exists("lock"), "released")
+
+	// refreshed while running
+	err = client.WithLock(ctx, "lock", time.Millisecond*150, func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * 400):
+			return nil
+		}
+	}, WithLockRefresh(time.Millisecond*30))
+	assert.NoError(t, err)
+}
+
+func TestWithLockContention(t *testing.T) {
+	_, client := newLockClient(t)
+	ctx := context.Background()
+
+	lock, err := client.Obtain(ctx, "contention", time.Minute, nil)
+	require.NoError(t, err)
+	defer lock.Release(ctx)
+
+	called := false
+	err = client.WithLock(ctx, "contention", time.Second, func(ctx context.Context) error {
+		called = true
+		return nil
+	}, WithLockRetry(redislock.NoRetry()))
+	assert.Equal(t, ErrLockNotObtained, err)
+	assert.False(t, called)
+	assert.Equal(t, float64(1), testutil.ToFloat64(lockContentions.WithLabelValues(defaultLockName)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(lockContentions.WithLabelValues("contention")), "key is not label")
+}
+
+func TestWithLockRefresh(t *testing.T) {
+	s, client := newLockClient(t)
+	ctx := context.Background()
+
+	fn := func(ctx context.Context) error {
+		t.Error("fn called")
+		return nil
+	}
+	assert.Equal(t, ErrLockRefresh, client.WithLock(ctx, "refresh", time.Second, fn, WithLockRefresh(0)))
+	assert.Equal(t, ErrLockRefresh, client.WithLock(ctx, "refresh", time.Second, fn, WithLockRefresh(-time.Second)))
+	assert.Equal(t, ErrLockRefresh, client.WithLock(ctx, "refresh", 2, fn))
+	assert.False(t, s.Exists("refresh"))
+}
+
+func TestWithLockLost(t *testing.T) {
+	s, client := newLockClient(t)
+
+	err := client.WithLock(context.Background(), "lost", time.Second, func(ctx context.Context) error {
+		s.Del("lost")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second * 5):
+			return nil
+		}
+	}, WithLockRefresh(time.Millisecond*20), WithLockName("lost-lock"))
+	assert.Equal(t, ErrLockLost, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(lockLosts.WithLabelValues("lost-lock")))
+}
@@ -0,0 +1,161 @@
+package redisx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	metricsNamespace = "redis"
+	commandPipeline  = "pipeline"
+)
+
+var (
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "command_duration_seconds",
+		Help:      "Redis command duration",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"name", "command"})
+
+	commandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "command_errors_total",
+		Help:      "Number of redis command errors, redis.Nil excluded",
+	}, []string{"name", "command"})
+
+	lockContentions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "lock",
+		Name:      "contentions_total",
+		Help:      "Number of locks not obtained as held by others",
+	}, []string{"name"})
+
+	lockLosts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "lock",
+		Name:      "lost_total",
+		Help:      "Number of locks lost while holding",
+	}, []string{"name"})
+
+	poolStats = newPoolStatsCollector()
+)
+
+func init() {
+	prometheus.MustRegister(poolStats)
+}
+
+type metricsStartKey struct{}
+
+// redisMetrics prometheus hook records command latency & errors, labeled by config name
+type redisMetrics struct {
+	name string
+}
+
+func (redisMetrics) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsStartKey{}, time.Now()), nil
+}
+
+func (t redisMetrics) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	t.observe(ctx, cmd.Name(), cmd)
+	return nil
+}
+
+func (redisMetrics) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsStartKey{}, time.Now()), nil
+}
+
+func (t redisMetrics) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	t.observe(ctx, commandPipeline, nil)
+	for _, cmd := range cmds {
+		if isError(cmd.Err()) {
+			commandErrors.WithLabelValues(t.name, cmd.Name()).Inc()
+		}
+	}
+	return nil
+}
+
+func (t redisMetrics) observe(ctx context.Context, command string, cmd redis.Cmder) {
+	if start, ok := ctx.Value(metricsStartKey{}).(time.Time); ok {
+		commandDuration.WithLabelValues(t.name, command).Observe(time.Since(start).Seconds())
+	}
+	if cmd != nil && isError(cmd.Err()) {
+		commandErrors.WithLabelValues(t.name, command).Inc()
+	}
+}
+
+func isError(err error) bool {
+	return err != nil && err != redis.Nil
+}
+
+// poolStatsCollector collects connection pool stats of clients
+type poolStatsCollector struct {
+	mu      sync.RWMutex
+	clients map[string]redis.UniversalClient
+
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+func newPoolStatsCollector() *poolStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "pool", name), help, []string{"name"}, nil)
+	}
+
+	return &poolStatsCollector{
+		clients:    make(map[string]redis.UniversalClient),
+		hits:       desc("hits_total", "Number of times free connection was found in the pool"),
+		misses:     desc("misses_total", "Number of times free connection was not found in the pool"),
+		timeouts:   desc("timeouts_total", "Number of times a wait timeout occurred"),
+		totalConns: desc("total_conns", "Number of total connections in the pool"),
+		idleConns:  desc("idle_conns", "Number of idle connections in the pool"),
+		staleConns: desc("stale_conns_total", "Number of stale connections removed from the pool"),
+	}
+}
+
+func (t *poolStatsCollector) add(name string, client redis.UniversalClient) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clients[name] = client
+}
+
+func (t *poolStatsCollector) remove(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.clients, name)
+}
+
+// Describe implements prometheus.Collector
+func (t *poolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.hits
+	ch <- t.misses
+	ch <- t.timeouts
+	ch <- t.totalConns
+	ch <- t.idleConns
+	ch <- t.staleConns
+}
+
+// Collect implements prometheus.Collector
+func (t *poolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for name, client := range t.clients {
+		stats := client.PoolStats()
+		ch <- prometheus.MustNewConstMetric(t.hits, prometheus.CounterValue, float64(stats.Hits), name)
+		ch <- prometheus.MustNewConstMetric(t.misses, prometheus.CounterValue, float64(stats.Misses), name)
+		ch <- prometheus.MustNewConstMetric(t.timeouts, prometheus.CounterValue, float64(stats.Timeouts), name)
+		ch <- prometheus.MustNewConstMetric(t.totalConns, prometheus.GaugeValue, float64(stats.TotalConns), name)
+		ch <- prometheus.MustNewConstMetric(t.idleConns, prometheus.GaugeValue, float64(stats.IdleConns), name)
+		ch <- prometheus.MustNewConstMetric(t.staleConns, prometheus.CounterValue, float64(stats.StaleConns), name)
+	}
+}
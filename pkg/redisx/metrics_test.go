@@ -0,0 +1,66 @@
+package redisx
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisMetrics(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+	client.AddHook(&redisMetrics{name: "metrics"})
+
+	ctx := context.Background()
+	require.NoError(t, client.Set(ctx, "key", "value", 0).Err())
+	assert.Equal(t, redis.Nil, client.Get(ctx, "missing").Err())
+	assert.Error(t, client.Incr(ctx, "key").Err())
+
+	_, err := client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Get(ctx, "key")
+		p.Incr(ctx, "key")
+		return nil
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, uint64(1), sampleCount(t, "metrics", "get"))
+	assert.Equal(t, float64(0), testutil.ToFloat64(commandErrors.WithLabelValues("metrics", "get")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(commandErrors.WithLabelValues("metrics", "incr")))
+	assert.Equal(t, uint64(1), sampleCount(t, "metrics", commandPipeline))
+}
+
+func sampleCount(t *testing.T, name, command string) uint64 {
+	var m dto.Metric
+	require.NoError(t, commandDuration.WithLabelValues(name, command).(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestPoolStatsCollector(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+	require.NoError(t, client.Ping(context.Background()).Err())
+
+	collector := newPoolStatsCollector()
+	collector.add("pool", client)
+
+	expected := `
+# HELP redis_pool_total_conns Number of total connections in the pool
+# TYPE redis_pool_total_conns gauge
+redis_pool_total_conns{name="pool"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "redis_pool_total_conns"))
+	assert.Equal(t, 6, testutil.CollectAndCount(collector))
+
+	collector.remove("pool")
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+}
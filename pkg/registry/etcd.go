@@ -0,0 +1,245 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/core"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+type etcdRegistry struct {
+	client  *clientv3.Client
+	manager endpoints.Manager
+	ttl     int64 // seconds
+
+	mu        sync.Mutex
+	endpoints map[string]Endpoint // etcd key -> endpoint
+	leaseID   clientv3.LeaseID
+	running   bool
+}
+
+// NewEtcd create etcd registry, endpoints registered with lease and keepalive in background
+// refer: https://etcd.io/docs/v3.5/dev-guide/grpc_naming/
+func NewEtcd(client *clientv3.Client) Registry {
+	em, _ := endpoints.NewManager(client, core.ServiceRegisterKeyPrefix)
+	return &etcdRegistry{
+		client:    client,
+		manager:   em,
+		ttl:       10,
+		endpoints: make(map[string]Endpoint, 8),
+	}
+}
+
+// Register registers service endpoint with lease
+func (t *etcdRegistry) Register(ctx context.Context, service string, endpoint Endpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := t.key(service, endpoint.ID)
+	t.endpoints[key] = endpoint
+
+	if !t.running {
+		t.running = true
+		go t.keepalive()
+	}
+
+	if t.leaseID == 0 {
+		return t.grant(ctx)
+	}
+
+	return t.put(ctx, t.leaseID, key, endpoint)
+}
+
+// Deregister removes service endpoint, lease will be revoked if no endpoint left
+func (t *etcdRegistry) Deregister(ctx context.Context, service string, endpoint Endpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := t.key(service, endpoint.ID)
+	delete(t.endpoints, key)
+
+	err := t.manager.DeleteEndpoint(ctx, key)
+
+	if len(t.endpoints) == 0 && t.leaseID != 0 {
+		_, _ = t.client.Revoke(ctx, t.leaseID)
+		t.leaseID = 0
+	}
+
+	return err
+}
+
+// Resolve returns current endpoints of service
+func (t *etcdRegistry) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	prefix := t.prefix(service)
+	em, err := endpoints.NewManager(t.client, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	eps, err := em.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Endpoint, 0, len(eps))
+	for key, ep := range eps {
+		result = append(result, Endpoint{ID: strings.TrimPrefix(key, prefix), Addr: ep.Addr, Metadata: ep.Metadata})
+	}
+
+	return sortEndpoints(result), nil
+}
+
+// Watch watches endpoints of service
+func (t *etcdRegistry) Watch(ctx context.Context, service string) (<-chan []Endpoint, error) {
+	prefix := t.prefix(service)
+	em, err := endpoints.NewManager(t.client, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	wch, err := em.NewWatchChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []Endpoint, 1)
+	go func() {
+		defer close(ch)
+
+		current := make(map[string]Endpoint, 8)
+		apply := func(updates []*endpoints.Update) {
+			for _, up := range updates {
+				id := strings.TrimPrefix(up.Key, prefix)
+				switch up.Op {
+				case endpoints.Add:
+					current[id] = Endpoint{ID: id, Addr: up.Endpoint.Addr, Metadata: up.Endpoint.Metadata}
+				case endpoints.Delete:
+					delete(current, id)
+				}
+			}
+		}
+		snapshot := func() []Endpoint {
+			result := make([]Endpoint, 0, len(current))
+			for _, ep := range current {
+				result = append(result, ep)
+			}
+			return sortEndpoints(result)
+		}
+
+		// initial endpoints already in channel if exists
+		select {
+		case updates := <-wch:
+			apply(updates)
+		default:
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- snapshot():
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case updates, ok := <-wch:
+				if !ok {
+					return
+				}
+				apply(updates)
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (t *etcdRegistry) key(service, id string) string {
+	return fmt.Sprint(t.prefix(service), id)
+}
+
+func (t *etcdRegistry) prefix(service string) string {
+	return fmt.Sprint(core.ServiceRegisterKeyPrefix, "/", service, "/")
+}
+
+// grant grant new lease and put all endpoints, should be called with lock held
+func (t *etcdRegistry) grant(ctx context.Context) error {
+	rsp, err := t.client.Grant(ctx, t.ttl)
+	if err != nil {
+		return err
+	}
+
+	for key, endpoint := range t.endpoints {
+		if err = t.put(ctx, rsp.ID, key, endpoint); err != nil {
+			return err
+		}
+	}
+
+	t.leaseID = rsp.ID
+
+	return nil
+}
+
+func (t *etcdRegistry) put(ctx context.Context, id clientv3.LeaseID, key string, endpoint Endpoint) error {
+	return t.manager.AddEndpoint(ctx, key, endpoints.Endpoint{
+		Addr:     endpoint.Addr,
+		Metadata: endpoint.Metadata,
+	}, clientv3.WithLease(id))
+}
+
+// keepalive keep lease alive until all endpoints deregistered
+func (t *etcdRegistry) keepalive() {
+	l := log.Named("registry.etcd")
+	defer func() {
+		if x := recover(); x != nil {
+			l.Error("recover", zap.Any("err", x))
+
+			time.Sleep(time.Second * 10)
+			go t.keepalive()
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+
+	for {
+		if !t.keepaliveOnce(l) {
+			return
+		}
+
+		// wait next loop
+		<-ticker.C
+	}
+}
+
+func (t *etcdRegistry) keepaliveOnce(l log.Logger) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.endpoints) == 0 {
+		t.running = false
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if t.leaseID == 0 {
+		if err := t.grant(ctx); err != nil {
+			l.Error("lease.Grant", zap.Error(err))
+		}
+	} else if _, err := t.client.KeepAliveOnce(ctx, t.leaseID); err != nil {
+		t.leaseID = 0
+	}
+
+	return true
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+type fileRegistry struct {
+	file     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	modTime  time.Time
+	services map[string][]string
+}
+
+// NewFile create static file registry, file is yaml (or json) format, service name as key
+// and addresses as value, file will be reloaded when changed, e.g.
+//
+//	hello/buf.v1.GreeterService:
+//	  - 127.0.0.1:5000
+//	  - 127.0.0.1:5001
+//
+// Register & Deregister are ignored, for host without etcd
+func NewFile(file string) Registry {
+	return &fileRegistry{
+		file:     file,
+		interval: time.Second * 5,
+	}
+}
+
+// Register ignored, static file is read only
+func (t *fileRegistry) Register(ctx context.Context, service string, endpoint Endpoint) error {
+	return nil
+}
+
+// Deregister ignored, static file is read only
+func (t *fileRegistry) Deregister(ctx context.Context, service string, endpoint Endpoint) error {
+	return nil
+}
+
+// Resolve returns endpoints of service in file
+func (t *fileRegistry) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	services, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := services[service]
+	result := make([]Endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		result = append(result, Endpoint{ID: addr, Addr: addr})
+	}
+	return result, nil
+}
+
+// Watch watches endpoints of service, file is checked periodically
+func (t *fileRegistry) Watch(ctx context.Context, service string) (<-chan []Endpoint, error) {
+	current, err := t.Resolve(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []Endpoint, 1)
+	ch <- current
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			eps, err := t.Resolve(ctx, service)
+			if err != nil {
+				log.Warn("registry file reload", zap.String("file", t.file), zap.Error(err))
+				continue
+			}
+			if reflect.DeepEqual(eps, current) {
+				continue
+			}
+			current = eps
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- current:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// load parse file if modified since last load
+func (t *fileRegistry) load() (map[string][]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stat, err := os.Stat(t.file)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.services != nil && stat.ModTime().Equal(t.modTime) {
+		return t.services, nil
+	}
+
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string][]string, 8)
+	if err = yaml.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+
+	t.services = services
+	t.modTime = stat.ModTime()
+
+	return services, nil
+}
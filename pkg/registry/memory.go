@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"context"
+	"sync"
+)
+
+type memoryRegistry struct {
+	mu       sync.RWMutex
+	services map[string]map[string]Endpoint
+	watchers map[string]map[chan []Endpoint]struct{}
+}
+
+// NewMemory create in-memory registry, which only works in the same process, useful for testing
+func NewMemory() Registry {
+	return &memoryRegistry{
+		services: make(map[string]map[string]Endpoint, 8),
+		watchers: make(map[string]map[chan []Endpoint]struct{}, 8),
+	}
+}
+
+// Register registers service endpoint
+func (t *memoryRegistry) Register(ctx context.Context, service string, endpoint Endpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	eps, ok := t.services[service]
+	if !ok {
+		eps = make(map[string]Endpoint, 4)
+		t.services[service] = eps
+	}
+	eps[endpoint.ID] = endpoint
+
+	t.notify(service)
+	return nil
+}
+
+// Deregister removes service endpoint
+func (t *memoryRegistry) Deregister(ctx context.Context, service string, endpoint Endpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if eps, ok := t.services[service]; ok {
+		delete(eps, endpoint.ID)
+	}
+
+	t.notify(service)
+	return nil
+}
+
+// Resolve returns current endpoints of service
+func (t *memoryRegistry) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.snapshot(service), nil
+}
+
+// Watch watches endpoints of service
+func (t *memoryRegistry) Watch(ctx context.Context, service string) (<-chan []Endpoint, error) {
+	ch := make(chan []Endpoint, 1)
+
+	t.mu.Lock()
+	ws, ok := t.watchers[service]
+	if !ok {
+		ws = make(map[chan []Endpoint]struct{}, 4)
+		t.watchers[service] = ws
+	}
+	ws[ch] = struct{}{}
+	ch <- t.snapshot(service)
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.watchers[service], ch)
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+func (t *memoryRegistry) snapshot(service string) []Endpoint {
+	eps := t.services[service]
+	result := make([]Endpoint, 0, len(eps))
+	for _, ep := range eps {
+		result = append(result, ep)
+	}
+	return sortEndpoints(result)
+}
+
+// notify send latest snapshot to watchers, should be called with lock held
+func (t *memoryRegistry) notify(service string) {
+	for ch := range t.watchers[service] {
+		// drop stale snapshot, only latest one is useful
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- t.snapshot(service)
+	}
+}
@@ -0,0 +1,55 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Endpoint is a service instance which could be dialed by client
+type Endpoint struct {
+	ID       string      `json:"id" yaml:"id"`             // instance id, unique in service
+	Addr     string      `json:"addr" yaml:"addr"`         // dial address, e.g. 192.168.1.10:5000
+	Metadata interface{} `json:"metadata" yaml:"metadata"` // optional metadata
+}
+
+// Registry is the service registry interface, which used for service register & discovery
+//
+// service is the full service name, see ServiceName
+type Registry interface {
+	// Register registers service endpoint, register again with same endpoint id will overwrite it
+	Register(ctx context.Context, service string, endpoint Endpoint) error
+
+	// Deregister removes service endpoint
+	Deregister(ctx context.Context, service string, endpoint Endpoint) error
+
+	// Resolve returns current endpoints of service
+	Resolve(ctx context.Context, service string) ([]Endpoint, error)
+
+	// Watch watches endpoints of service, full endpoints snapshot will be sent when changed,
+	// channel will be closed when ctx done
+	Watch(ctx context.Context, service string) (<-chan []Endpoint, error)
+}
+
+// ServiceName returns full service name for registry, e.g. hello/buf.v1.GreeterService
+func ServiceName(name, grpcServiceName string) string {
+	return fmt.Sprint(name, "/", grpcServiceName)
+}
+
+// InstanceID returns current instance id, format host-pid-{pid}
+func InstanceID() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "unknown-host"
+	}
+	return fmt.Sprint(host, "-pid-", os.Getpid())
+}
+
+// sortEndpoints sort endpoints by id for stable snapshot
+func sortEndpoints(endpoints []Endpoint) []Endpoint {
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].ID < endpoints[j].ID
+	})
+	return endpoints
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_memory(t *testing.T) {
+	r := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := ServiceName("hello", "buf.v1.GreeterService")
+
+	ch, err := r.Watch(ctx, service)
+	assert.NoError(t, err)
+	assert.Empty(t, <-ch)
+
+	ep := Endpoint{ID: "a", Addr: "127.0.0.1:5000"}
+	assert.NoError(t, r.Register(ctx, service, ep))
+	assert.Equal(t, []Endpoint{ep}, <-ch)
+
+	eps, err := r.Resolve(ctx, service)
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{ep}, eps)
+
+	assert.NoError(t, r.Deregister(ctx, service, ep))
+	assert.Empty(t, <-ch)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func Test_file(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "registry.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("hello/buf.v1.GreeterService:\n  - 127.0.0.1:5000\n"), 0644))
+
+	r := NewFile(file)
+	r.(*fileRegistry).interval = time.Millisecond * 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := ServiceName("hello", "buf.v1.GreeterService")
+	eps, err := r.Resolve(ctx, service)
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{ID: "127.0.0.1:5000", Addr: "127.0.0.1:5000"}}, eps)
+
+	ch, err := r.Watch(ctx, service)
+	assert.NoError(t, err)
+	assert.Len(t, <-ch, 1)
+
+	data := []byte("hello/buf.v1.GreeterService:\n  - 127.0.0.1:5000\n  - 127.0.0.1:5001\n")
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	// make sure mod time changed
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+
+	select {
+	case eps = <-ch:
+		assert.Len(t, eps, 2)
+	case <-time.After(time.Second):
+		t.Fatal("watch timeout")
+	}
+}
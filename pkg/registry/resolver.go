@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the grpc resolver scheme for registry, e.g. xservice:///hello/buf.v1.GreeterService
+const Scheme = "xservice"
+
+type resolverBuilder struct {
+	registry Registry
+}
+
+// NewResolverBuilder create grpc resolver builder base on registry watch
+func NewResolverBuilder(registry Registry) resolver.Builder {
+	return &resolverBuilder{registry: registry}
+}
+
+// Build creates a new resolver for the given target
+func (t *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	service := strings.TrimPrefix(target.URL.Path, "/")
+	if service == "" {
+		service = target.URL.Opaque
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := t.registry.Watch(ctx, service)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	r := &registryResolver{cancel: cancel}
+
+	go func() {
+		for eps := range ch {
+			addrs := make([]resolver.Address, 0, len(eps))
+			for _, ep := range eps {
+				// tls server name of endpoint, default authority is the target path which never matches certificate
+				host, _, err := net.SplitHostPort(ep.Addr)
+				if err != nil {
+					host = ep.Addr
+				}
+				addrs = append(addrs, resolver.Address{Addr: ep.Addr, ServerName: host, Metadata: ep.Metadata})
+			}
+			_ = cc.UpdateState(resolver.State{Addresses: addrs})
+		}
+	}()
+
+	return r, nil
+}
+
+// Scheme returns the scheme supported by this resolver
+func (t *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+type registryResolver struct {
+	cancel context.CancelFunc
+}
+
+// ResolveNow ignored, endpoints are watched
+func (t *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close stop watching
+func (t *registryResolver) Close() {
+	t.cancel()
+}
@@ -1,46 +1,89 @@
 package signalx
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 )
 
+type signalKey struct{}
+
 var (
 	shutdownHooks      = make([]ShutdownHook, 0, 64)
 	shutdownHooksMutex sync.Mutex
+	shutdownHooksOnce  sync.Once
 )
 
 type ShutdownHook func(os.Signal)
 
+// AddShutdownHook add shutdown hook, all shutdown hooks run sequentially in registration order as one global
+// lifecycle stop hook with default priority and timeout, hooks not yet run after timeout are skipped
+//
+// Deprecated: use lifecycle.OnStop for ordering & timeout & error report
 func AddShutdownHook(hook ShutdownHook) {
 	shutdownHooksMutex.Lock()
 	defer shutdownHooksMutex.Unlock()
 	shutdownHooks = append(shutdownHooks, hook)
+
+	shutdownHooksOnce.Do(func() {
+		lifecycle.OnStop("shutdown-hooks", runShutdownHooks)
+	})
 }
 
+func runShutdownHooks(ctx context.Context) error {
+	shutdownHooksMutex.Lock()
+	hooks := append([]ShutdownHook(nil), shutdownHooks...)
+	shutdownHooksMutex.Unlock()
+
+	sig := Signal(ctx)
+	for _, fn := range hooks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fn(sig)
+	}
+	return nil
+}
+
+// ShutdownListen wait signal and run global lifecycle stop hooks
 func ShutdownListen(signals ...os.Signal) {
+	ShutdownListenWithReport(signals...)
+}
+
+// ShutdownListenWithReport wait signal and run global lifecycle stop hooks, returns report of stop phase
+func ShutdownListenWithReport(signals ...os.Signal) *lifecycle.Report {
 	ch := make(chan os.Signal, 1)
 	if len(signals) == 0 {
 		signals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT}
 	}
 	signal.Notify(ch, signals...)
 	sig := <-ch
-	var wg sync.WaitGroup
-	for i := len(shutdownHooks) - 1; i >= 0; i-- {
-		wg.Add(1)
-		go func(sig os.Signal, fn func(os.Signal)) {
-			defer wg.Done()
-			fn(sig)
-		}(sig, shutdownHooks[i])
-	}
-	wg.Wait()
+	return lifecycle.Stop(WithSignal(context.Background(), sig))
 }
 
 // Shutdown direct shutdown without signal
 func Shutdown() {
-	for i := len(shutdownHooks) - 1; i >= 0; i-- {
-		shutdownHooks[i](syscall.SIGTERM)
+	ShutdownWithReport()
+}
+
+// ShutdownWithReport direct shutdown without signal, returns report of stop phase
+func ShutdownWithReport() *lifecycle.Report {
+	return lifecycle.Stop(WithSignal(context.Background(), syscall.SIGTERM))
+}
+
+// WithSignal returns context with shutdown signal
+func WithSignal(ctx context.Context, sig os.Signal) context.Context {
+	return context.WithValue(ctx, signalKey{}, sig)
+}
+
+// Signal returns shutdown signal from context, default SIGTERM
+func Signal(ctx context.Context) os.Signal {
+	if sig, ok := ctx.Value(signalKey{}).(os.Signal); ok {
+		return sig
 	}
+	return syscall.SIGTERM
 }
@@ -0,0 +1,31 @@
+package signalx
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownHook(t *testing.T) {
+	var order []int
+	var signals []os.Signal
+	for i := 0; i < 3; i++ {
+		i := i
+		AddShutdownHook(func(sig os.Signal) {
+			// run sequentially, no lock required
+			order = append(order, i)
+			signals = append(signals, sig)
+		})
+	}
+
+	report := ShutdownWithReport()
+	assert.NoError(t, report.Err())
+	assert.Len(t, report.Results, 1)
+	assert.Equal(t, []int{0, 1, 2}, order)
+	assert.Equal(t, []os.Signal{syscall.SIGTERM, syscall.SIGTERM, syscall.SIGTERM}, signals)
+
+	// stop phase run once
+	assert.Same(t, report, ShutdownWithReport())
+}
@@ -0,0 +1,229 @@
+package tlsx
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+// Config for tls configuration, e.g.
+//
+//	http:
+//	  tls:
+//	    cert: /etc/xservice/server.crt
+//	    key: /etc/xservice/server.key
+//	    clientCA: /etc/xservice/ca.crt
+//	    mtls: true
+type Config struct {
+	Cert           string `yaml:"cert"`           // certificate file
+	Key            string `yaml:"key"`            // private key file
+	ClientCA       string `yaml:"clientCA"`       // CA file for verify client certificate, also used for verify peers when dial
+	MTLS           bool   `yaml:"mtls"`           // require & verify client certificate
+	ServerName     string `yaml:"serverName"`     // server name for verify peers when dial, default use host of dial address
+	ReloadInterval int    `yaml:"reloadInterval"` // seconds for check files changed, default 10
+}
+
+// Enabled check whether tls configured
+func (t Config) Enabled() bool {
+	return t.Cert != "" && t.Key != ""
+}
+
+// Reloader hold certificates which reloaded when files changed
+type Reloader struct {
+	config Config
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewReloader create reloader and load certificates
+func NewReloader(config Config) (*Reloader, error) {
+	if config.ReloadInterval <= 0 {
+		config.ReloadInterval = 10
+	}
+
+	r := &Reloader{config: config}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch reload certificates periodically if files changed until ctx done
+func (t *Reloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * time.Duration(t.config.ReloadInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !t.changed() {
+			continue
+		}
+
+		if err := t.load(); err != nil {
+			log.Error("reload tls certificate", zap.Error(err))
+			continue
+		}
+		log.Info("tls certificate reloaded", zap.String("cert", t.config.Cert))
+	}
+}
+
+// ServerConfig returns tls config for server, certificates are resolved per handshake
+func (t *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := t.get()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"h2", "http/1.1"},
+				Certificates: []tls.Certificate{*cert},
+			}
+			if pool != nil {
+				cfg.ClientCAs = pool
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				if t.config.MTLS {
+					cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig returns tls config for dial peers, client certificate is provided for mtls,
+// peers are verified by client CA if configured, otherwise system roots
+func (t *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.config.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := t.get()
+			return cert, nil
+		},
+		// verify manually with current pool, since RootCAs could not be reloaded
+		InsecureSkipVerify: true, // #nosec G402
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, pool := t.get()
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("tls: no peer certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
+
+// SelfClientConfig returns tls config for dial to self, e.g. grpc gateway, which only trusts own current certificate,
+// since listen address may not match host of certificate
+func (t *Reloader) SelfClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := t.get()
+			return cert, nil
+		},
+		// pin own certificate instead of verify host
+		InsecureSkipVerify: true, // #nosec G402
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			cert, _ := t.get()
+			if len(cs.PeerCertificates) == 0 || len(cert.Certificate) == 0 {
+				return errors.New("tls: no peer certificate")
+			}
+			if !bytes.Equal(cs.PeerCertificates[0].Raw, cert.Certificate[0]) {
+				return errors.New("tls: peer certificate is not own certificate")
+			}
+			return nil
+		},
+	}
+}
+
+func (t *Reloader) get() (*tls.Certificate, *x509.CertPool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.cert, t.pool
+}
+
+func (t *Reloader) files() []string {
+	files := []string{t.config.Cert, t.config.Key}
+	if t.config.ClientCA != "" {
+		files = append(files, t.config.ClientCA)
+	}
+	return files
+}
+
+func (t *Reloader) changed() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, file := range t.files() {
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !stat.ModTime().Equal(t.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Reloader) load() error {
+	modTimes := make(map[string]time.Time, 3)
+	for _, file := range t.files() {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = stat.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.config.Cert, t.config.Key)
+	if err != nil {
+		return errors.Wrap(err, "load key pair")
+	}
+
+	var pool *x509.CertPool
+	if t.config.ClientCA != "" {
+		data, err := os.ReadFile(t.config.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.Errorf("invalid client CA: %s", t.config.ClientCA)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cert = &cert
+	t.pool = pool
+	t.modTimes = modTimes
+
+	return nil
+}
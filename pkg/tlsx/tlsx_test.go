@@ -0,0 +1,148 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/xinpianchang/xservice/pkg/registry"
+)
+
+// writeCert generate self signed certificate for 127.0.0.1, which is also the CA
+func writeCert(t *testing.T, dir string, cn string) Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	cfg := Config{
+		Cert:     filepath.Join(dir, "server.crt"),
+		Key:      filepath.Join(dir, "server.key"),
+		ClientCA: filepath.Join(dir, "server.crt"),
+		MTLS:     true,
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.NoError(t, os.WriteFile(cfg.Cert, certPem, 0600))
+	assert.NoError(t, os.WriteFile(cfg.Key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return cfg
+}
+
+func handshake(t *testing.T, server, client *tls.Config) (string, error) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), client)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func Test_mtls(t *testing.T) {
+	cfg := writeCert(t, t.TempDir(), "v1")
+	r, err := NewReloader(cfg)
+	assert.NoError(t, err)
+
+	cn, err := handshake(t, r.ServerConfig(), r.ClientConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", cn)
+
+	// rotate
+	writeCert(t, filepath.Dir(cfg.Cert), "v2")
+	assert.NoError(t, os.Chtimes(cfg.Cert, time.Now(), time.Now().Add(time.Second)))
+	assert.True(t, r.changed())
+	assert.NoError(t, r.load())
+
+	cn, err = handshake(t, r.ServerConfig(), r.ClientConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", cn)
+}
+
+func Test_selfClientConfig(t *testing.T) {
+	r, err := NewReloader(writeCert(t, t.TempDir(), "self"))
+	assert.NoError(t, err)
+	other, err := NewReloader(writeCert(t, t.TempDir(), "other"))
+	assert.NoError(t, err)
+
+	cn, err := handshake(t, r.ServerConfig(), r.SelfClientConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "self", cn)
+
+	// trusted by client CA, but not own certificate
+	_, err = handshake(t, other.ServerConfig(), r.SelfClientConfig())
+	assert.Error(t, err)
+}
+
+func Test_grpcRegistry(t *testing.T) {
+	r, err := NewReloader(writeCert(t, t.TempDir(), "grpc"))
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(r.ServerConfig())))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(ln) }()
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	reg := registry.NewMemory()
+	service := registry.ServiceName("hello", healthpb.Health_ServiceDesc.ServiceName)
+	require.NoError(t, reg.Register(ctx, service, registry.Endpoint{ID: "1", Addr: ln.Addr().String()}))
+
+	// authority is hello/grpc.health.v1.Health, server name must be host of endpoint
+	conn, err := grpc.DialContext(ctx, registry.Scheme+":///"+service,
+		grpc.WithTransportCredentials(credentials.NewTLS(r.ClientConfig())),
+		grpc.WithResolvers(registry.NewResolverBuilder(reg)),
+		grpc.WithBlock(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	rsp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, rsp.Status)
+}
@@ -1,6 +1,7 @@
 package tracingx
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -14,13 +15,32 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/xinpianchang/xservice/core"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
 	"github.com/xinpianchang/xservice/pkg/log"
-	"github.com/xinpianchang/xservice/pkg/signalx"
 )
 
-// Config config tracing
-//  currently only works with jaeger
+const (
+	ProviderJaeger        = "jaeger" // jaeger client with opentracing, default
+	ProviderOpenTelemetry = "otel"   // opentelemetry with opentracing bridge
+)
+
+// Config config tracing, provider selected by tracing.provider, default jaeger
+//
+// opentelemetry provider bridged to opentracing, so that builtin opentracing
+// instrumentation works with both providers
 func Config(v *viper.Viper) {
+	switch provider := v.GetString("tracing.provider"); provider {
+	case "", ProviderJaeger:
+		configJaeger(v)
+	case ProviderOpenTelemetry:
+		configOpenTelemetry(v)
+	default:
+		log.Fatal("unsupported tracing provider", zap.String("provider", provider))
+	}
+}
+
+// configJaeger config jaeger tracer, configuration refer: https://www.jaegertracing.io/docs/1.23/client-features
+func configJaeger(v *viper.Viper) {
 	serviceName := os.Getenv(core.EnvServiceName)
 
 	for k, v := range v.GetStringMapString("jaeger") {
@@ -56,9 +76,9 @@ func Config(v *viper.Viper) {
 		log.Fatal("create tracer", zap.Error(err))
 	}
 
-	signalx.AddShutdownHook(func(os.Signal) {
-		_ = closer.Close()
-	})
+	lifecycle.OnStop("tracing", func(context.Context) error {
+		return closer.Close()
+	}, lifecycle.WithPriority(lifecycle.PriorityTracing))
 
 	opentracing.SetGlobalTracer(tracer)
 }
@@ -0,0 +1,150 @@
+package tracingx
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	otelbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.uber.org/zap"
+
+	"github.com/xinpianchang/xservice/core"
+	"github.com/xinpianchang/xservice/pkg/lifecycle"
+	"github.com/xinpianchang/xservice/pkg/log"
+)
+
+const (
+	ExporterOTLPGrpc = "otlpgrpc" // otlp over grpc, default
+	ExporterOTLPHttp = "otlphttp" // otlp over http
+	ExporterMemory   = "memory"   // in-memory, for testing
+)
+
+var (
+	memoryExporter     *tracetest.InMemoryExporter
+	memoryExporterOnce sync.Once
+)
+
+// otelConfig opentelemetry configuration, e.g.
+//
+//	tracing:
+//	  provider: otel
+//	  exporter: otlpgrpc
+//	  endpoint: 127.0.0.1:4317
+//	  insecure: true
+//	  sampler: 1
+type otelConfig struct {
+	Provider string            `yaml:"provider"`
+	Exporter string            `yaml:"exporter"` // otlpgrpc, otlphttp, memory
+	Endpoint string            `yaml:"endpoint"` // collector endpoint, default use OTEL_EXPORTER_OTLP_ENDPOINT env
+	Insecure bool              `yaml:"insecure"` // disable tls for collector
+	Headers  map[string]string `yaml:"headers"`  // additional headers for collector
+	Sampler  float64           `yaml:"sampler"`  // trace id ratio based sampler, default 1 (always)
+}
+
+// MemoryExporter returns the in-memory exporter which used by memory exporter config, for testing
+func MemoryExporter() *tracetest.InMemoryExporter {
+	memoryExporterOnce.Do(func() {
+		memoryExporter = tracetest.NewInMemoryExporter()
+	})
+	return memoryExporter
+}
+
+// configOpenTelemetry config opentelemetry tracer provider with w3c trace context propagation,
+// and set opentracing global tracer via bridge
+func configOpenTelemetry(v *viper.Viper) {
+	var cfg otelConfig
+	if err := v.UnmarshalKey("tracing", &cfg); err != nil {
+		log.Fatal("read tracing config", zap.Error(err))
+	}
+
+	if !v.IsSet("tracing.sampler") {
+		cfg.Sampler = 1
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(os.Getenv(core.EnvServiceName)),
+		semconv.ServiceVersionKey.String(os.Getenv(core.EnvServiceVersion)),
+	))
+	if err != nil {
+		log.Fatal("tracing resource", zap.Error(err))
+	}
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Sampler))),
+	}
+
+	switch cfg.Exporter {
+	case ExporterMemory:
+		options = append(options, sdktrace.WithSyncer(MemoryExporter()))
+	case "", ExporterOTLPGrpc, ExporterOTLPHttp:
+		exporter, err := newOTLPExporter(cfg)
+		if err != nil {
+			log.Fatal("create tracing exporter", zap.Error(err))
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	default:
+		log.Fatal("unsupported tracing exporter", zap.String("exporter", cfg.Exporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(options...)
+
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	otel.SetTextMapPropagator(propagator)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warn("opentelemetry", zap.Error(err))
+	}))
+
+	bridgeTracer, wrapperProvider := otelbridge.NewTracerPair(tp.Tracer(os.Getenv(core.EnvServiceName)))
+	bridgeTracer.SetTextMapPropagator(propagator)
+	bridgeTracer.SetWarningHandler(func(msg string) {
+		log.Debug("opentracing bridge", zap.String("msg", msg))
+	})
+
+	otel.SetTracerProvider(wrapperProvider)
+	opentracing.SetGlobalTracer(bridgeTracer)
+
+	lifecycle.OnStop("tracing", func(ctx context.Context) error {
+		return tp.Shutdown(ctx)
+	}, lifecycle.WithPriority(lifecycle.PriorityTracing))
+}
+
+func newOTLPExporter(cfg otelConfig) (*otlptrace.Exporter, error) {
+	if cfg.Exporter == ExporterOTLPHttp {
+		options := make([]otlptracehttp.Option, 0, 3)
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		return otlptracehttp.New(context.Background(), options...)
+	}
+
+	options := make([]otlptracegrpc.Option, 0, 3)
+	if cfg.Endpoint != "" {
+		options = append(options, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		options = append(options, otlptracegrpc.WithHeaders(cfg.Headers))
+	}
+	return otlptracegrpc.New(context.Background(), options...)
+}
@@ -0,0 +1,44 @@
+package tracingx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestOpenTelemetry(t *testing.T) {
+	v := viper.New()
+	v.Set("tracing.provider", ProviderOpenTelemetry)
+	v.Set("tracing.exporter", ExporterMemory)
+	Config(v)
+
+	exporter := MemoryExporter()
+	exporter.Reset()
+
+	span, ctx := opentracing.StartSpanFromContext(context.Background(), "parent")
+	traceID, spanID := GetTraceID(ctx), GetSpanID(ctx)
+	assert.Len(t, traceID, 32)
+	assert.Len(t, spanID, 16)
+
+	// w3c traceparent propagation
+	carrier := opentracing.TextMapCarrier{}
+	assert.NoError(t, opentracing.GlobalTracer().Inject(span.Context(), opentracing.TextMap, carrier))
+	assert.Contains(t, carrier["traceparent"], traceID)
+
+	remote := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(carrier))
+	_, child := otel.Tracer("test").Start(remote, "child")
+	assert.Equal(t, traceID, child.SpanContext().TraceID().String())
+	child.End()
+	span.Finish()
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	for _, s := range spans {
+		assert.Equal(t, traceID, s.SpanContext.TraceID().String())
+	}
+}
@@ -0,0 +1,55 @@
+// Package tracectx extract trace id & span id from context, works with both jaeger and opentelemetry provider
+//
+// this package has no dependency of xservice log, which could be used by log itself
+package tracectx
+
+import (
+	"context"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	headerTraceParent = "traceparent" // w3c trace context header
+)
+
+// SpanIDs returns trace id & span id of span in context, empty if no span
+func SpanIDs(ctx context.Context) (traceID, spanID string) {
+	if ctx == nil {
+		return
+	}
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		return FromSpan(span)
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return sc.TraceID().String(), sc.SpanID().String()
+	}
+
+	return
+}
+
+// FromSpan returns trace id & span id of opentracing span
+func FromSpan(span opentracing.Span) (traceID, spanID string) {
+	if sc, ok := span.Context().(jaeger.SpanContext); ok {
+		return sc.TraceID().String(), sc.SpanID().String()
+	}
+
+	// opentelemetry bridge span context is not exported, extract from w3c traceparent,
+	// format: {version}-{trace-id}-{parent-id}-{trace-flags}
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		return
+	}
+
+	parts := strings.Split(carrier[headerTraceParent], "-")
+	if len(parts) != 4 {
+		return
+	}
+
+	return parts[1], parts[2]
+}
@@ -3,16 +3,17 @@ package tracingx
 import (
 	"context"
 
-	"github.com/opentracing/opentracing-go"
-	"github.com/uber/jaeger-client-go"
+	"github.com/xinpianchang/xservice/pkg/tracingx/tracectx"
 )
 
+// GetTraceID get trace id from context, works with both jaeger and opentelemetry provider
 func GetTraceID(ctx context.Context) string {
-	if span := opentracing.SpanFromContext(ctx); span != nil {
-		if sc, ok := span.Context().(jaeger.SpanContext); ok {
-			return sc.TraceID().String()
-		}
-	}
+	traceID, _ := tracectx.SpanIDs(ctx)
+	return traceID
+}
 
-	return ""
+// GetSpanID get span id from context, works with both jaeger and opentelemetry provider
+func GetSpanID(ctx context.Context) string {
+	_, spanID := tracectx.SpanIDs(ctx)
+	return spanID
 }
@@ -0,0 +1,258 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/xinpianchang/xservice/pkg/gormx"
+	"github.com/xinpianchang/xservice/pkg/gormx/migrate"
+)
+
+var (
+	MigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "database schema migration of SQL files, {version}_{name}.up.sql & {version}_{name}.down.sql",
+		Long: `database schema migration of SQL files, {version}_{name}.up.sql & {version}_{name}.down.sql
+
+database is read from entry of service config by name, or specified by driver & datasource.
+Go migrations registered in service are recorded in separated table, and only applied on service startup,
+see migrateOnStartup of database config.
+
+a failed migration is marked as dirty, fix the schema manually and then resolve it by force.`,
+	}
+
+	upCmd = &cobra.Command{
+		Use:   "up",
+		Short: "apply all pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := make([]migrate.Option, 0, 1)
+			if outOfOrder, _ := cmd.Flags().GetBool("out-of-order"); outOfOrder {
+				opts = append(opts, migrate.WithOutOfOrder())
+			}
+			m, err := newMigrator(cmd, opts...)
+			if err != nil {
+				return err
+			}
+			n, err := m.Up(context.Background())
+			fmt.Println("applied:", n)
+			return err
+		},
+	}
+
+	downCmd = &cobra.Command{
+		Use:   "down [steps]",
+		Short: "revert last applied migrations, default 1 step",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps := 1
+			if len(args) > 0 {
+				var err error
+				if steps, err = strconv.Atoi(args[0]); err != nil || steps <= 0 {
+					return errors.Errorf("invalid steps: %v", args[0])
+				}
+			}
+
+			m, err := newMigrator(cmd)
+			if err != nil {
+				return err
+			}
+			n, err := m.Down(context.Background(), steps)
+			fmt.Println("reverted:", n)
+			return err
+		},
+	}
+
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "show status of migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := newMigrator(cmd)
+			if err != nil {
+				return err
+			}
+			list, err := m.Status(context.Background())
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+			for _, s := range list {
+				status, appliedAt := "pending", ""
+				switch {
+				case s.Dirty:
+					status = "dirty"
+				case s.Missing:
+					status = "missing"
+				case s.OutOfOrder:
+					status = "out of order"
+				case s.Changed:
+					status = "changed"
+				case s.Applied:
+					status = "applied"
+				}
+				if s.Applied {
+					appliedAt = s.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", s.Version, s.Name, status, appliedAt)
+			}
+			return w.Flush()
+		},
+	}
+
+	forceCmd = &cobra.Command{
+		Use:   "force <version> applied|pending",
+		Short: "resolve dirty migration after schema fixed manually, mark it as applied or pending",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[1] != "applied" && args[1] != "pending" {
+				return errors.Errorf("invalid state %v, applied or pending", args[1])
+			}
+
+			m, err := newMigrator(cmd)
+			if err != nil {
+				return err
+			}
+			return m.Force(context.Background(), args[0], args[1] == "applied")
+		},
+	}
+
+	createCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "create up & down SQL files versioned by current time",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := migrationDir(cmd)
+			if err != nil {
+				return err
+			}
+			files, err := migrate.Create(dir, args[0])
+			for _, file := range files {
+				fmt.Println("created:", file)
+			}
+			return err
+		},
+	}
+)
+
+func init() {
+	MigrateCmd.AddCommand(upCmd, downCmd, statusCmd, forceCmd, createCmd)
+	for _, cmd := range MigrateCmd.Commands() {
+		// usage is not helpful for migration errors
+		cmd.SilenceUsage = true
+	}
+
+	upCmd.Flags().Bool("out-of-order", false, "apply pending migrations lower than the highest applied")
+
+	// not bound to viper, keys like datasource & dir are shared with other commands
+	pf := MigrateCmd.PersistentFlags()
+	pf.StringP("config", "c", "config.yaml", "service config file, database entry is read from")
+	pf.StringP("name", "n", "", "database entry name of service config, default the first")
+	pf.String("driver", gormx.DriverMySQL, "db driver, used with datasource")
+	pf.StringP("datasource", "d", "", "datasource, used instead of service config, e.g. root:123456@(127.0.0.1:3306)/test")
+	pf.String("dir", "", "migration files dir, default migrationDir of database entry or migrations/{name}")
+	pf.String("table", migrate.DefaultTable, "table of migration records")
+	pf.Duration("lock-timeout", time.Minute*5, "max duration to wait lock held by others")
+}
+
+// dbConfig database entry of service config or flags
+func dbConfig(cmd *cobra.Command) (gormx.DbConfig, error) {
+	flags := cmd.Flags()
+	name, _ := flags.GetString("name")
+	driver, _ := flags.GetString("driver")
+	datasource, _ := flags.GetString("datasource")
+
+	if datasource != "" {
+		if name == "" {
+			name = "default"
+		}
+		return gormx.DbConfig{Name: name, Driver: driver, Uri: datasource}, nil
+	}
+
+	file, _ := flags.GetString("config")
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return gormx.DbConfig{}, errors.Wrap(err, "read config")
+	}
+
+	var cfg []gormx.DbConfig
+	if err := v.UnmarshalKey("database", &cfg); err != nil {
+		return gormx.DbConfig{}, errors.Wrap(err, "read database config")
+	}
+	for _, c := range cfg {
+		if name == "" || c.Name == name {
+			return c, nil
+		}
+	}
+	return gormx.DbConfig{}, errors.Errorf("database %q not found in %v", name, file)
+}
+
+func migrationDir(cmd *cobra.Command) (string, error) {
+	if dir, _ := cmd.Flags().GetString("dir"); dir != "" {
+		return dir, nil
+	}
+	cfg, err := dbConfig(cmd)
+	if err != nil {
+		return "", err
+	}
+	if cfg.MigrationDir != "" {
+		return cfg.MigrationDir, nil
+	}
+	return fmt.Sprint("migrations/", cfg.Name), nil
+}
+
+func newMigrator(cmd *cobra.Command, opts ...migrate.Option) (*migrate.Migrator, error) {
+	cfg, err := dbConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := migrationDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.LoadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "load migrations")
+	}
+
+	db, err := openDb(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	table, _ := cmd.Flags().GetString("table")
+	lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
+	opts = append(opts, migrate.WithTable(table), migrate.WithLockTimeout(lockTimeout))
+	return migrate.New(db, migrations, opts...)
+}
+
+// openDb open primary of database config, with plain logger of warn level
+func openDb(cfg gormx.DbConfig) (*gorm.DB, error) {
+	if cfg.Driver == "" {
+		cfg.Driver = gormx.DriverMySQL
+	}
+	opener, ok := gormx.GetOpener(cfg.Driver)
+	if !ok {
+		return nil, errors.Errorf("unsupported db driver %v", cfg.Driver)
+	}
+
+	db, err := gorm.Open(opener(cfg.Uri), &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+	if err != nil {
+		return nil, errors.Wrap(err, "open db")
+	}
+	return db, nil
+}
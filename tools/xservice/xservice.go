@@ -8,6 +8,7 @@ import (
 	"github.com/xinpianchang/xservice"
 	"github.com/xinpianchang/xservice/tools/xservice/generator"
 	"github.com/xinpianchang/xservice/tools/xservice/gogen"
+	"github.com/xinpianchang/xservice/tools/xservice/migrate"
 	"github.com/xinpianchang/xservice/tools/xservice/model"
 )
 
@@ -41,6 +42,7 @@ func main() {
 		gogen.NewCmd,
 		model.ModelCmd,
 		generator.StatusMapGeneratorCmd,
+		migrate.MigrateCmd,
 	)
 
 	if err := rootCmd.Execute(); err != nil {